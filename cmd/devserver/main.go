@@ -0,0 +1,308 @@
+// Command devserver serves the site natively over net/http, without WASM or
+// wrangler, for working on pages and the CMS sync locally. Content is kept in
+// a file-backed store and static files are served from public/.
+//
+//	go run ./cmd/devserver -addr :8787
+//	curl 'localhost:8787/admin/sync?secret=test'
+//
+// /admin/sync reads the same variables as the worker: DRIVE_FOLDER_ID,
+// GOOGLE_API_KEY, COSPLAY_DRIVE_FOLDER_ID, PHOTOS_ALBUM_PREFIX,
+// SNAPSHOTS_KEPT, DRIVE_CONCURRENCY, PUBLISH_MAX_DELETE_PERCENT,
+// PUBLISH_MIN_POSTS, PUBLISH_MIN_ALBUMS and ADMIN_SECRET. The worker
+// refreshes a Photos OAuth token itself; here a ready token can be given in
+// PHOTOS_ACCESS_TOKEN.
+package main
+
+import (
+	"cloudflare-worker-boilerplate/cms"
+	"cloudflare-worker-boilerplate/site"
+	"cloudflare-worker-boilerplate/store"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type server struct {
+	store        store.Store
+	sync         site.SyncConfig
+	adminSecret  string
+	photosClient *cms.PhotosClient // nil without PHOTOS_ACCESS_TOKEN
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8787", "address to listen on")
+	dataDir := flag.String("data", ".devdata", "directory for the file-backed KV store")
+	publicDir := flag.String("public", "public", "directory of static files")
+	flag.Parse()
+
+	st, err := store.NewFile(*dataDir)
+	if err != nil {
+		log.Fatalf("opening store: %v", err)
+	}
+
+	s := &server{
+		store: st,
+		sync: site.SyncConfig{
+			DriveFolderID:     os.Getenv("DRIVE_FOLDER_ID"),
+			DriveAPIKey:       os.Getenv("GOOGLE_API_KEY"),
+			PhotosAccessToken: os.Getenv("PHOTOS_ACCESS_TOKEN"),
+			PhotosAlbumPrefix: os.Getenv("PHOTOS_ALBUM_PREFIX"),
+			CosplayFolderID:   os.Getenv("COSPLAY_DRIVE_FOLDER_ID"),
+		},
+		adminSecret: os.Getenv("ADMIN_SECRET"),
+	}
+	s.sync.SnapshotsKept = envInt("SNAPSHOTS_KEPT")
+	s.sync.DriveConcurrency = envInt("DRIVE_CONCURRENCY")
+	s.sync.Checks = cms.PublishChecks{
+		MaxDeletePercent: envInt("PUBLISH_MAX_DELETE_PERCENT"),
+		MinPosts:         envInt("PUBLISH_MIN_POSTS"),
+		MinAlbums:        envInt("PUBLISH_MIN_ALBUMS"),
+	}
+	if s.adminSecret == "" {
+		s.adminSecret = "test" // same fallback as worker.js
+	}
+	if s.sync.PhotosAccessToken != "" {
+		s.photosClient = cms.NewPhotosClient("", nil, s.sync.PhotosAccessToken)
+	}
+
+	log.Printf("Serving on http://%s (data in %s, static files from %s)", *addr, *dataDir, *publicDir)
+	log.Fatal(http.ListenAndServe(*addr, s.routes(*publicDir)))
+}
+
+// envInt reads a numeric variable, 0 when unset or not a number
+func envInt(name string) int {
+	n, _ := strconv.Atoi(os.Getenv(name))
+	return n
+}
+
+func (s *server) routes(publicDir string) http.Handler {
+	mux := http.NewServeMux()
+
+	// Pages, matching ROUTES and PREFIX_ROUTES in worker.js
+	mux.HandleFunc("GET /{$}", page(site.Home))
+	mux.HandleFunc("GET /home", page(site.Home))
+	mux.HandleFunc("GET /resume", page(site.Resume))
+	mux.HandleFunc("GET /base", page(site.Base))
+	mux.HandleFunc("GET /dynamic", page(func() string { return site.DynamicContent(time.Now()) }))
+	mux.HandleFunc("GET /blog", page(func() string { return site.Blog(s.store) }))
+	mux.HandleFunc("GET /blog/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		writeHTML(w, site.BlogPost(s.store, r.PathValue("slug")))
+	})
+	mux.HandleFunc("GET /cosplays", func(w http.ResponseWriter, r *http.Request) {
+		// The same URL serves a full page or an htmx fragment
+		w.Header().Set("Vary", "HX-Request")
+		fragment := r.Header.Get("HX-Request") == "true" && r.Header.Get("HX-History-Restore-Request") != "true"
+		writeHTML(w, site.Response{Status: 200, Body: site.Cosplays(s.store, r.URL.RawQuery, fragment)})
+	})
+	mux.HandleFunc("GET /cosplays/series", page(func() string { return site.CosplaySeries(s.store) }))
+	mux.HandleFunc("GET /cosplays/timeline", page(func() string { return site.CosplayTimeline(s.store) }))
+	mux.HandleFunc("GET /cosplays/album/{id}", func(w http.ResponseWriter, r *http.Request) {
+		resp := site.CosplayAlbum(s.store, r.PathValue("id"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.Status)
+		fmt.Fprint(w, resp.Body)
+	})
+
+	// Admin
+	mux.HandleFunc("/admin/sync", s.handleSync)
+	mux.HandleFunc("/admin/cover", s.handleCover)
+	mux.HandleFunc("/admin/snapshots", s.handleSnapshots)
+	mux.HandleFunc("/admin/snapshots/diff", s.handleSnapshotDiff)
+	mux.HandleFunc("/admin/snapshots/rollback", s.handleRollback)
+	mux.HandleFunc("/admin/migrate", s.handleMigrate)
+
+	// Image proxies. Locally the browser is just sent to Google.
+	mux.HandleFunc("GET /gdrivephoto/{id...}", handleDrivePhoto)
+	mux.HandleFunc("GET /gdocimage/{key}", s.handleDocImage)
+	mux.HandleFunc("GET /gphoto/{id}", s.handlePhoto)
+
+	mux.Handle("/", http.FileServer(http.Dir(publicDir)))
+	return mux
+}
+
+func page(render func() string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHTML(w, site.Response{Status: 200, Body: render()})
+	}
+}
+
+func writeHTML(w http.ResponseWriter, resp site.Response) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(resp.Status)
+	fmt.Fprint(w, resp.Body)
+}
+
+func writeText(w http.ResponseWriter, status int, text string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprint(w, text)
+}
+
+func (s *server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.URL.Query().Get("secret") != s.adminSecret {
+		writeText(w, http.StatusUnauthorized, "Unauthorized")
+		return false
+	}
+	return true
+}
+
+// writeAdmin answers like the worker's adminResponse: JSON, or text with
+// ?format=text or Accept: text/plain
+func writeAdmin(w http.ResponseWriter, r *http.Request, result site.AdminResult) {
+	accept := r.Header.Get("Accept")
+	if r.URL.Query().Get("format") == "text" ||
+		(strings.Contains(accept, "text/plain") && !strings.Contains(accept, "application/json")) {
+		writeText(w, result.Status, result.Text)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(result.Status)
+	fmt.Fprint(w, result.JSON)
+}
+
+// handleSync runs the CMS sync into the local store
+func (s *server) handleSync(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	cfg := s.sync
+	if key := r.URL.Query().Get("photos_key"); key != "" {
+		cfg.PhotosAccessToken = key
+	}
+	if cfg.DriveFolderID == "" || cfg.DriveAPIKey == "" {
+		writeText(w, http.StatusInternalServerError, "Missing Configuration (DRIVE_FOLDER_ID or GOOGLE_API_KEY)")
+		return
+	}
+
+	writeAdmin(w, r, site.Sync(s.store, cfg))
+}
+
+func (s *server) handleSnapshots(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	writeAdmin(w, r, site.Snapshots(s.store))
+}
+
+// handleSnapshotDiff is /admin/snapshots/diff?secret=...&from=<id>&to=<id>
+func (s *server) handleSnapshotDiff(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	from, _ := strconv.Atoi(r.URL.Query().Get("from"))
+	to, _ := strconv.Atoi(r.URL.Query().Get("to"))
+	writeAdmin(w, r, site.DiffSnapshots(s.store, from, to))
+}
+
+// handleRollback is POST /admin/snapshots/rollback?secret=...&id=<id>
+func (s *server) handleRollback(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeText(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		writeText(w, http.StatusBadRequest, "Missing id")
+		return
+	}
+	writeAdmin(w, r, site.RollbackSnapshot(s.store, id))
+}
+
+// handleMigrate is POST /admin/migrate?secret=...
+func (s *server) handleMigrate(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeText(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	writeAdmin(w, r, site.Migrate(s.store))
+}
+
+// handleCover is POST /admin/cover?secret=...&album=<albumId>&cover=<position|filename>
+func (s *server) handleCover(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeText(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	albumID := r.URL.Query().Get("album")
+	if albumID == "" {
+		writeText(w, http.StatusBadRequest, "Missing album")
+		return
+	}
+	result := site.SetCover(s.store, albumID, r.URL.Query().Get("cover"))
+	writeText(w, result.Status, result.Body)
+}
+
+func handleDrivePhoto(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.NotFound(w, r)
+		return
+	}
+	target := "https://drive.google.com/uc?id=" + url.QueryEscape(id)
+	if width := r.URL.Query().Get("w"); width != "" {
+		target = fmt.Sprintf("https://drive.google.com/thumbnail?id=%s&sz=w%s", url.QueryEscape(id), url.QueryEscape(width))
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// handleDocImage serves an image from a Google Doc stored by the sync
+func (s *server) handleDocImage(w http.ResponseWriter, r *http.Request) {
+	img, found, err := cms.LoadDocImage(s.store, r.PathValue("key"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", img.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	w.Write(img.Data)
+}
+
+func (s *server) handlePhoto(w http.ResponseWriter, r *http.Request) {
+	baseURL, err := cms.ResolvePhotoURL(s.store, s.photosClient, r.PathValue("id"))
+	if errors.Is(err, cms.ErrPhotoNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Photo Error: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	if baseURL == "" {
+		http.Error(w, "Photos access not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	// =dv streams a video, =wN a still at the width asked for by srcset
+	suffix := "=w1920-h1080"
+	if width := r.URL.Query().Get("w"); width != "" {
+		suffix = "=w" + url.QueryEscape(width)
+	}
+	if r.URL.Query().Get("kind") == "video" {
+		suffix = "=dv"
+	}
+	http.Redirect(w, r, baseURL+suffix, http.StatusFound)
+}
@@ -0,0 +1,108 @@
+package cms
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Default API endpoints. Tests and local development can point the clients
+// at an httptest server instead.
+const (
+	DefaultDriveBaseURL  = "https://www.googleapis.com"
+	DefaultPhotosBaseURL = "https://photoslibrary.googleapis.com"
+)
+
+// DriveClient talks to the Google Drive v3 API using an API key
+type DriveClient struct {
+	BaseURL string
+	APIKey  string
+	HTTP    *http.Client
+	Retry   RetryPolicy
+
+	// Concurrency is the number of files downloaded in parallel during a
+	// sync, defaultDriveConcurrency unless DRIVE_CONCURRENCY sets it
+	Concurrency int
+}
+
+const defaultDriveConcurrency = 4
+
+// NewDriveClient creates a Drive client. An empty baseURL means
+// DefaultDriveBaseURL and a nil transport means http.DefaultTransport.
+func NewDriveClient(baseURL string, transport http.RoundTripper, apiKey string) *DriveClient {
+	if baseURL == "" {
+		baseURL = DefaultDriveBaseURL
+	}
+	return &DriveClient{
+		BaseURL:     strings.TrimSuffix(baseURL, "/"),
+		APIKey:      apiKey,
+		HTTP:        &http.Client{Transport: transport},
+		Retry:       DefaultRetryPolicy,
+		Concurrency: defaultDriveConcurrency,
+	}
+}
+
+// get issues a GET for path under BaseURL with the API key appended,
+// retrying rate limits and server errors
+func (c *DriveClient) get(path string, params url.Values) (*http.Response, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("key", c.APIKey)
+	target := c.BaseURL + path + "?" + params.Encode()
+	return c.Retry.do(c.HTTP, func() (*http.Request, error) {
+		return http.NewRequest("GET", target, nil)
+	})
+}
+
+// PhotosClient talks to the Google Photos Library API using an OAuth access token
+type PhotosClient struct {
+	BaseURL     string
+	AccessToken string
+	HTTP        *http.Client
+	Retry       RetryPolicy
+
+	// AlbumPrefix, when set, selects albums by title prefix instead of the
+	// "Title | Series" naming convention. The prefix is stripped from titles.
+	AlbumPrefix string
+}
+
+// NewPhotosClient creates a Photos client. An empty baseURL means
+// DefaultPhotosBaseURL and a nil transport means http.DefaultTransport.
+func NewPhotosClient(baseURL string, transport http.RoundTripper, accessToken string) *PhotosClient {
+	if baseURL == "" {
+		baseURL = DefaultPhotosBaseURL
+	}
+	return &PhotosClient{
+		BaseURL:     strings.TrimSuffix(baseURL, "/"),
+		AccessToken: accessToken,
+		HTTP:        &http.Client{Transport: transport},
+		Retry:       DefaultRetryPolicy,
+	}
+}
+
+// newRequest builds an authorized request for path under BaseURL
+func (c *PhotosClient) newRequest(method, path string, body string) (*http.Request, error) {
+	var req *http.Request
+	var err error
+	if body == "" {
+		req, err = http.NewRequest(method, c.BaseURL+path, nil)
+	} else {
+		req, err = http.NewRequest(method, c.BaseURL+path, strings.NewReader(body))
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", "Bearer "+c.AccessToken)
+	if body != "" {
+		req.Header.Add("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// send performs an authorized request, retrying rate limits and server errors
+func (c *PhotosClient) send(method, path string, body string) (*http.Response, error) {
+	return c.Retry.do(c.HTTP, func() (*http.Request, error) {
+		return c.newRequest(method, path, body)
+	})
+}
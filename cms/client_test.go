@@ -0,0 +1,558 @@
+package cms
+
+import (
+	"cloudflare-worker-boilerplate/store"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDrive serves the parts of the Drive v3 API the sync uses: listing a
+// folder's children, split into pages of pageSize, and downloading a file
+type fakeDrive struct {
+	folders  map[string][]DriveFile
+	contents map[string]string
+	pageSize int
+
+	mu        sync.Mutex
+	queries   []string
+	downloads map[string]int
+}
+
+func (f *fakeDrive) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("key") != "test-key" {
+		http.Error(w, "missing API key", http.StatusForbidden)
+		return
+	}
+
+	if r.URL.Path == "/drive/v3/files" {
+		q := r.URL.Query().Get("q")
+		f.mu.Lock()
+		f.queries = append(f.queries, q)
+		f.mu.Unlock()
+
+		folderID, ok := parseParentsQuery(q)
+		if !ok {
+			http.Error(w, "bad query "+q, http.StatusBadRequest)
+			return
+		}
+		files := f.folders[folderID]
+		start := 0
+		if token := r.URL.Query().Get("pageToken"); token != "" {
+			json.Unmarshal([]byte(token), &start)
+		}
+		end := len(files)
+		var resp DriveListResponse
+		if f.pageSize > 0 && start+f.pageSize < end {
+			end = start + f.pageSize
+			next, _ := json.Marshal(end)
+			resp.NextPageToken = string(next)
+		}
+		resp.Files = files[start:end]
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/drive/v3/files/")
+	content, ok := f.contents[id]
+	if !ok || r.URL.Query().Get("alt") != "media" {
+		http.NotFound(w, r)
+		return
+	}
+	f.mu.Lock()
+	f.downloads[id]++
+	f.mu.Unlock()
+	w.Write([]byte(content))
+}
+
+// parseParentsQuery undoes escapeDriveQuery on "'<id>' in parents and ..."
+func parseParentsQuery(q string) (string, bool) {
+	if !strings.HasPrefix(q, "'") {
+		return "", false
+	}
+	var b strings.Builder
+	for i := 1; i < len(q); i++ {
+		switch q[i] {
+		case '\\':
+			i++
+			if i < len(q) {
+				b.WriteByte(q[i])
+			}
+		case '\'':
+			return b.String(), strings.HasPrefix(q[i+1:], " in parents and trashed = false")
+		default:
+			b.WriteByte(q[i])
+		}
+	}
+	return "", false
+}
+
+func newTestDriveClient(t *testing.T, drive *fakeDrive) *DriveClient {
+	t.Helper()
+	drive.downloads = map[string]int{}
+	server := httptest.NewServer(drive)
+	t.Cleanup(server.Close)
+
+	c := NewDriveClient(server.URL, nil, "test-key")
+	c.Retry = RetryPolicy{} // fail fast
+	return c
+}
+
+func TestSyncBlogPosts(t *testing.T) {
+	drive := &fakeDrive{
+		folders: map[string][]DriveFile{
+			"blog": {
+				{ID: "f1", Name: "hello.md", MimeType: "text/markdown", ModifiedTime: "2024-01-01T00:00:00Z", Md5Checksum: "a"},
+				{ID: "tutorials", Name: "Tutorials", MimeType: driveFolderMimeType},
+				{ID: "f2", Name: "draft.md", MimeType: "text/markdown", ModifiedTime: "2024-01-02T00:00:00Z", Md5Checksum: "b"},
+			},
+			"tutorials": {
+				{ID: "f3", Name: "wigs.md", MimeType: "text/markdown", ModifiedTime: "2024-01-03T00:00:00Z", Md5Checksum: "c"},
+			},
+		},
+		contents: map[string]string{
+			"f1": "Title: Hello\nTags: a, b\n---\nFirst *post*",
+			"f2": "---\ntitle: Draft\nstatus: draft\n---\nNot yet",
+			"f3": "Title: Styling wigs\n---\nBody",
+		},
+		pageSize: 2,
+	}
+	c := newTestDriveClient(t, drive)
+
+	first, err := c.SyncBlogPosts("blog", nil, nil)
+	if err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+	if first.Added != 3 || first.Failed != 0 || len(first.Errors) != 0 {
+		t.Fatalf("first sync: added %d, failed %d, errors %v", first.Added, first.Failed, first.Errors)
+	}
+
+	byID := map[string]BlogPost{}
+	for _, p := range first.Posts {
+		byID[p.ID] = p
+	}
+	if got := byID["f1"]; got.Title != "Hello" || got.Slug != "hello" || !strings.Contains(got.HTMLContent, "<em>post</em>") {
+		t.Errorf("f1 = %+v", got)
+	}
+	if got := byID["f2"]; got.Status != StatusDraft {
+		t.Errorf("f2 status = %q, want draft", got.Status)
+	}
+	if got := byID["f3"]; got.Type != "Tutorials" {
+		t.Errorf("f3 type = %q, want the subfolder name", got.Type)
+	}
+	if len(first.Manifest) != 3 {
+		t.Errorf("manifest has %d entries, want 3", len(first.Manifest))
+	}
+
+	// Nothing changed, so the second sync reuses every post without
+	// downloading it again
+	second, err := c.SyncBlogPosts("blog", first.Manifest, first.Posts)
+	if err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	if second.Unchanged != 3 || second.Changed() {
+		t.Errorf("second sync: unchanged %d, changed %v", second.Unchanged, second.Changed())
+	}
+	for id, n := range drive.downloads {
+		if n != 1 {
+			t.Errorf("%s downloaded %d times, want 1", id, n)
+		}
+	}
+
+	// An edited file is downloaded again and a deleted one dropped
+	drive.folders["blog"][0].ModifiedTime = "2024-02-01T00:00:00Z"
+	drive.contents["f1"] = "Title: Hello again\n---\nEdited"
+	drive.folders["blog"] = drive.folders["blog"][:2]
+	third, err := c.SyncBlogPosts("blog", second.Manifest, second.Posts)
+	if err != nil {
+		t.Fatalf("third sync: %v", err)
+	}
+	if third.Updated != 1 || third.Removed != 1 || third.Unchanged != 1 {
+		t.Errorf("third sync: updated %d, removed %d, unchanged %d", third.Updated, third.Removed, third.Unchanged)
+	}
+}
+
+func TestSyncBlogPostsKeepsSlug(t *testing.T) {
+	drive := &fakeDrive{
+		folders: map[string][]DriveFile{
+			"blog": {
+				{ID: "f1", Name: "ahri.md", MimeType: "text/markdown", ModifiedTime: "2024-01-01T00:00:00Z"},
+			},
+		},
+		contents: map[string]string{
+			"f1": "Title: Ahri cosplay\n---\nBody",
+		},
+	}
+	c := newTestDriveClient(t, drive)
+
+	run := func(manifest BlogManifest, previous []BlogPost, modified, content string) BlogSync {
+		t.Helper()
+		drive.folders["blog"][0].ModifiedTime = modified
+		drive.contents["f1"] = content
+		result, err := c.SyncBlogPosts("blog", manifest, previous)
+		if err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+		if len(result.Posts) != 1 {
+			t.Fatalf("got %d posts, want 1", len(result.Posts))
+		}
+		return result
+	}
+
+	first := run(nil, nil, "2024-01-01T00:00:00Z", "Title: Ahri cosplay\n---\nBody")
+	if got := first.Posts[0].Slug; got != "ahri-cosplay" {
+		t.Fatalf("slug = %q, want ahri-cosplay", got)
+	}
+
+	// Fixing the title must not move the post's URL
+	renamed := run(first.Manifest, first.Posts, "2024-02-01T00:00:00Z", "Title: Ahri cosplay (final)\n---\nBody")
+	if got := renamed.Posts[0]; got.Title != "Ahri cosplay (final)" || got.Slug != "ahri-cosplay" {
+		t.Errorf("after rename: title %q, slug %q, want slug ahri-cosplay", got.Title, got.Slug)
+	}
+
+	// An explicit Slug: still wins
+	moved := run(renamed.Manifest, renamed.Posts, "2024-03-01T00:00:00Z", "Title: Ahri cosplay (final)\nSlug: ahri\n---\nBody")
+	if got := moved.Posts[0].Slug; got != "ahri" {
+		t.Errorf("after Slug: field, slug = %q, want ahri", got)
+	}
+}
+
+func TestSyncBlogPostsReportsBadFiles(t *testing.T) {
+	drive := &fakeDrive{
+		folders: map[string][]DriveFile{
+			"blog": {
+				{ID: "ok", Name: "ok.md", MimeType: "text/markdown"},
+				{ID: "bad", Name: "bad.md", MimeType: "text/markdown"},
+				{ID: "gone", Name: "gone.md", MimeType: "text/markdown"},
+			},
+		},
+		contents: map[string]string{
+			"ok":  "Title: Fine\n---\nBody",
+			"bad": "---\ntitle: [unclosed\n---\nBody",
+		},
+	}
+	c := newTestDriveClient(t, drive)
+
+	result, err := c.SyncBlogPosts("blog", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Added != 1 || result.Failed != 2 {
+		t.Fatalf("added %d, failed %d, want 1 and 2", result.Added, result.Failed)
+	}
+	var parseErrs, fetchErrs int
+	for _, err := range result.Errors {
+		switch err.(type) {
+		case *ParseError:
+			parseErrs++
+		case *FetchError:
+			fetchErrs++
+		}
+	}
+	if parseErrs != 1 || fetchErrs != 1 {
+		t.Errorf("got %d parse and %d fetch errors, want 1 of each: %v", parseErrs, fetchErrs, result.Errors)
+	}
+}
+
+func TestListFolderEscapesFolderID(t *testing.T) {
+	folderID := `it's a \ folder`
+	drive := &fakeDrive{
+		folders: map[string][]DriveFile{folderID: {{ID: "f1", Name: "a.md"}}},
+	}
+	c := newTestDriveClient(t, drive)
+
+	files, err := c.listFolder(folderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("got %d files, want 1", len(files))
+	}
+	if want := `'it\'s a \\ folder' in parents and trashed = false`; drive.queries[0] != want {
+		t.Errorf("query = %q, want %q", drive.queries[0], want)
+	}
+}
+
+func TestDriveFetchCosplayAlbums(t *testing.T) {
+	drive := &fakeDrive{
+		folders: map[string][]DriveFile{
+			"cosplays": {
+				{ID: "ahri", Name: "Ahri | League of Legends", MimeType: driveFolderMimeType},
+				{ID: "empty", Name: "Empty | Nothing", MimeType: driveFolderMimeType},
+				{ID: "notes", Name: "notes.txt", MimeType: "text/plain"},
+			},
+			"ahri": {
+				{ID: "p2", Name: "02.jpg", MimeType: "image/jpeg", Description: "Second"},
+				{ID: "meta", Name: "album.txt", MimeType: "text/plain"},
+				{ID: "v1", Name: "03.mp4", MimeType: "video/mp4"},
+				{ID: "p1", Name: "01.jpg", MimeType: "image/jpeg", ImageMediaMetadata: &DriveImageMetadata{Width: 4000, Height: 6000, Time: "2024:05:01 10:00:00"}},
+			},
+		},
+		contents: map[string]string{
+			"meta": "Photographer: Sam\nLocation: Studio\nCover: 2",
+		},
+	}
+	c := newTestDriveClient(t, drive)
+
+	result, err := c.FetchCosplayAlbums("cosplays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Albums) != 1 || len(result.Errors) != 1 {
+		t.Fatalf("got %d albums and %d errors, want 1 and 1", len(result.Albums), len(result.Errors))
+	}
+
+	album := result.Albums[0]
+	if album.Title != "Ahri" || album.Series != "League of Legends" {
+		t.Errorf("title %q, series %q", album.Title, album.Series)
+	}
+	if album.Photographer != "Sam" || album.Location != "Studio" || album.Cover != "2" {
+		t.Errorf("metadata = %+v", album)
+	}
+	var order []string
+	for _, m := range album.Images {
+		order = append(order, m.ID)
+	}
+	if got := strings.Join(order, ","); got != "p1,p2,v1" {
+		t.Errorf("media order = %s, want p1,p2,v1", got)
+	}
+	if album.Images[0].Width != 4000 || album.Images[0].TakenAt.IsZero() {
+		t.Errorf("first photo = %+v", album.Images[0])
+	}
+	if album.Images[2].Kind != MediaVideo {
+		t.Errorf("03.mp4 kind = %q, want video", album.Images[2].Kind)
+	}
+	if album.CoverImage != "/gdrivephoto/p1" {
+		t.Errorf("cover = %q; Cover: is applied later by applyCovers", album.CoverImage)
+	}
+}
+
+// fakePhotos serves the Photos Library API endpoints used by
+// PhotosClient.FetchCosplayAlbums, paging albums and media items
+type fakePhotos struct {
+	albums []Album
+	media  map[string][]MediaItem
+
+	// lookups counts GET /v1/mediaItems/<id> by ID
+	lookups map[string]int
+}
+
+func (f *fakePhotos) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/v1/albums":
+		// One album per page to exercise pagination
+		i := 0
+		if token := r.URL.Query().Get("pageToken"); token != "" {
+			json.Unmarshal([]byte(token), &i)
+		}
+		resp := AlbumsListResponse{Albums: f.albums[i : i+1]}
+		if i+1 < len(f.albums) {
+			next, _ := json.Marshal(i + 1)
+			resp.NextPageToken = string(next)
+		}
+		json.NewEncoder(w).Encode(resp)
+
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/v1/albums/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/albums/")
+		for _, a := range f.albums {
+			if a.ID == id {
+				json.NewEncoder(w).Encode(a)
+				return
+			}
+		}
+		http.NotFound(w, r)
+
+	case r.Method == "POST" && r.URL.Path == "/v1/mediaItems:search":
+		var search mediaSearchRequest
+		if err := json.NewDecoder(r.Body).Decode(&search); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		items := f.media[search.AlbumID]
+		// Two items per page
+		start := 0
+		if search.PageToken != "" {
+			json.Unmarshal([]byte(search.PageToken), &start)
+		}
+		end := min(start+2, len(items))
+		resp := PhotosListResponse{MediaItems: items[start:end]}
+		if end < len(items) {
+			next, _ := json.Marshal(end)
+			resp.NextPageToken = string(next)
+		}
+		json.NewEncoder(w).Encode(resp)
+
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/v1/mediaItems/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/mediaItems/")
+		if f.lookups != nil {
+			f.lookups[id]++
+		}
+		for _, items := range f.media {
+			for _, item := range items {
+				if item.ID == id {
+					json.NewEncoder(w).Encode(MediaItem{ID: id, BaseUrl: "https://photos.example/" + id})
+					return
+				}
+			}
+		}
+		http.Error(w, `{"error":{"status":"INVALID_ARGUMENT"}}`, http.StatusBadRequest)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestPhotosFetchCosplayAlbums(t *testing.T) {
+	photos := &fakePhotos{
+		albums: []Album{
+			{ID: "a1", Title: "Ahri | League of Legends"},
+			{ID: "a2", Title: "Holiday snaps"},
+			{ID: "a3", Title: "Empty | Series"},
+		},
+		media: map[string][]MediaItem{
+			"a1": {
+				{ID: "m1", MimeType: "image/jpeg", Description: "Photographer: Sam\nEvent: Con", MediaMetadata: MediaMetadata{Width: "4000", Height: "6000"}},
+				{ID: "m2", MimeType: "image/jpeg", Description: "Close-up"},
+				{ID: "m3", MimeType: "video/mp4"},
+			},
+		},
+	}
+	server := httptest.NewServer(photos)
+	t.Cleanup(server.Close)
+	c := NewPhotosClient(server.URL, nil, "test-token")
+	c.Retry = RetryPolicy{}
+
+	result, err := c.FetchCosplayAlbums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Albums) != 1 || len(result.Errors) != 1 {
+		t.Fatalf("got %d albums and %d errors, want 1 and 1 (a2 doesn't match, a3 is empty)", len(result.Albums), len(result.Errors))
+	}
+
+	album := result.Albums[0]
+	if album.Title != "Ahri" || album.Photographer != "Sam" || album.Event != "Con" {
+		t.Errorf("album = %+v", album)
+	}
+	if len(album.Images) != 3 {
+		t.Fatalf("got %d media items, want all 3 across pages", len(album.Images))
+	}
+	if album.Images[0].URL != "/gphoto/m1" || album.Images[0].Width != 4000 {
+		t.Errorf("first photo = %+v", album.Images[0])
+	}
+	if album.Images[0].Caption != "" || album.Images[1].Caption != "Close-up" {
+		t.Errorf("captions = %q, %q; album metadata isn't a caption", album.Images[0].Caption, album.Images[1].Caption)
+	}
+	if album.Images[2].Kind != MediaVideo || album.Images[2].URL != "/gphoto/m3?kind=video" {
+		t.Errorf("video = %+v", album.Images[2])
+	}
+
+	// The metadata photo's missing caption isn't worth a warning
+	var report SourceResult
+	warnMissingCaptions(&report, result.Albums)
+	if len(report.Warnings) != 1 || !strings.HasSuffix(report.Warnings[0].Message, "have no description: #3") {
+		t.Errorf("warnings = %+v, want only the video", report.Warnings)
+	}
+}
+
+func TestResolvePhotoURL(t *testing.T) {
+	photos := &fakePhotos{
+		media: map[string][]MediaItem{
+			"a1": {{ID: "m1"}, {ID: "gone"}},
+		},
+		lookups: map[string]int{},
+	}
+	server := httptest.NewServer(photos)
+	t.Cleanup(server.Close)
+	c := NewPhotosClient(server.URL, nil, "test-token")
+	c.Retry = RetryPolicy{}
+
+	st := store.NewMemory()
+	albums := []CosplayAlbum{{ID: "a1", Images: []CosplayMedia{
+		{ID: "m1", URL: PhotoProxyURL("m1")},
+		{ID: "gone", URL: PhotoProxyURL("gone")},
+		{ID: "d1", URL: "/gdrivephoto/d1"},
+	}}}
+	if err := writeContent(st, 1, content{Albums: albums}, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := setCurrentSnapshot(st, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a client a miss asks the caller for a token
+	if got, err := ResolvePhotoURL(st, nil, "m1"); got != "" || err != nil {
+		t.Errorf("cache miss without client = %q, %v", got, err)
+	}
+	for range 2 {
+		got, err := ResolvePhotoURL(st, c, "m1")
+		if err != nil || got != "https://photos.example/m1" {
+			t.Errorf("ResolvePhotoURL(m1) = %q, %v", got, err)
+		}
+	}
+	if photos.lookups["m1"] != 1 {
+		t.Errorf("m1 looked up %d times, want 1 then cached", photos.lookups["m1"])
+	}
+
+	// IDs outside the live albums never reach the API
+	for _, id := range []string{"random", "d1"} {
+		if _, err := ResolvePhotoURL(st, c, id); !errors.Is(err, ErrPhotoNotFound) {
+			t.Errorf("ResolvePhotoURL(%s) error = %v, want ErrPhotoNotFound", id, err)
+		}
+		if photos.lookups[id] != 0 {
+			t.Errorf("%s was looked up", id)
+		}
+	}
+
+	// A synced item Photos has lost is cached as missing
+	delete(photos.media, "a1")
+	for range 2 {
+		if _, err := ResolvePhotoURL(st, c, "gone"); !errors.Is(err, ErrPhotoNotFound) {
+			t.Errorf("ResolvePhotoURL(gone) error = %v, want ErrPhotoNotFound", err)
+		}
+		if _, err := ResolvePhotoURL(st, nil, "gone"); !errors.Is(err, ErrPhotoNotFound) {
+			t.Errorf("cached ResolvePhotoURL(gone) error = %v, want ErrPhotoNotFound", err)
+		}
+	}
+	if photos.lookups["gone"] != 1 {
+		t.Errorf("gone looked up %d times, want 1 then cached", photos.lookups["gone"])
+	}
+}
+
+func TestDownloadDocImagesKeysByContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("same image"))
+	}))
+	t.Cleanup(server.Close)
+	c := NewDriveClient(server.URL, nil, "test-key")
+	c.Retry = RetryPolicy{}
+
+	// Each export links the same image under a new URL
+	var keys []string
+	for _, export := range []string{"a", "b"} {
+		src := server.URL + "/export-" + export
+		img := docImage{Key: docImageKey([]byte(src)), Src: src}
+		post := BlogPost{HTMLContent: `<img src="` + docImagePath + img.Key + `"/>`, docImages: []docImage{img}}
+		if err := c.downloadDocImages(&post); err != nil {
+			t.Fatal(err)
+		}
+		got := docImageKeys(post.HTMLContent)
+		if len(got) != 1 || got[0] != post.docImages[0].Key {
+			t.Fatalf("export %s links %v, stored as %q", export, got, post.docImages[0].Key)
+		}
+		keys = append(keys, got[0])
+	}
+	if keys[0] != keys[1] {
+		t.Errorf("the same image got keys %v", keys)
+	}
+}
@@ -0,0 +1,414 @@
+package cms
+
+import (
+	"cloudflare-worker-boilerplate/store"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Each post and album is stored once, under a key made from a hash of its
+// JSON, so snapshots share the items that didn't change between them and a
+// sync only writes the ones that did. Each snapshot has index keys listing
+// its items in order with just what a card needs. Listing pages read an
+// index, and detail pages an index and one item:
+//
+//	content:00000012:blog_index     []postEntry, BlogPost without HTMLContent
+//	                                or Extra plus the hash of the whole post
+//	                                and the keys of the Docs images it links
+//	content:00000012:blog_manifest  BlogManifest
+//	content:00000012:cosplay_index  []albumEntry, CosplayAlbum without Images
+//	                                plus the hash of the whole album
+//	content:00000012:photo_ids      []string, the Photos media items served
+//	                                through /gphoto/, sorted
+//	item:post:<hash>                BlogPost
+//	item:album:<hash>               CosplayAlbum
+//	gdoc_image:<hash>               a Docs image, see doc_images.go
+//
+// Before snapshots existed each kind of content was stored as one blob, in
+// the unversioned blog_data, blog_manifest and cosplay_data keys. Those are
+// still read until MigrateContent turns them into the first snapshot.
+const (
+	contentPrefix = "content:"
+	itemPrefix    = "item:"
+)
+
+// Keys of the unversioned layout
+const (
+	legacyBlogKey     = "blog_data"
+	legacyManifestKey = "blog_manifest"
+	legacyCosplayKey  = "cosplay_data"
+)
+
+var legacyKeys = []string{legacyBlogKey, legacyManifestKey, legacyCosplayKey}
+
+// content is everything a sync produces, as stored in a snapshot
+type content struct {
+	Posts    []BlogPost
+	Manifest BlogManifest
+	Albums   []CosplayAlbum
+
+	// stored has the keys of the items content was read from, which
+	// saving it again doesn't need to write
+	stored map[string]bool
+}
+
+// postEntry is a post as listed in the blog index
+type postEntry struct {
+	BlogPost
+	Item   string   `json:"item"`
+	Images []string `json:"images,omitempty"`
+}
+
+// albumEntry is an album as listed in the cosplay index
+type albumEntry struct {
+	CosplayAlbum
+	Item string `json:"item"`
+}
+
+func contentKeyPrefix(id int) string {
+	return fmt.Sprintf("%s%08d:", contentPrefix, id)
+}
+
+func blogIndexKey(id int) string    { return contentKeyPrefix(id) + "blog_index" }
+func manifestKey(id int) string     { return contentKeyPrefix(id) + "blog_manifest" }
+func cosplayIndexKey(id int) string { return contentKeyPrefix(id) + "cosplay_index" }
+func photoIDsKey(id int) string     { return contentKeyPrefix(id) + "photo_ids" }
+
+func postItemKey(hash string) string  { return itemPrefix + "post:" + hash }
+func albumItemKey(hash string) string { return itemPrefix + "album:" + hash }
+
+// hashJSON identifies an item or a snapshot's content by its JSON
+func hashJSON(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:16])
+}
+
+// summary is the post as kept in the blog index
+func (p BlogPost) summary() BlogPost {
+	p.HTMLContent = ""
+	p.Extra = nil
+	return p
+}
+
+// summary is the album as kept in the cosplay index. TakenAt stands in for
+// the photos so ShotAt still works.
+func (a CosplayAlbum) summary() CosplayAlbum {
+	if _, ok := parseAlbumDate(a.Date); !ok {
+		a.TakenAt = a.ShotAt()
+	}
+	a.Images = nil
+	return a
+}
+
+// item is a post or album as stored under its hash
+type item struct {
+	key string
+	raw []byte
+}
+
+// indexContent builds c's index entries and the items they point to
+func indexContent(c content) ([]postEntry, []albumEntry, []item) {
+	posts := make([]postEntry, len(c.Posts))
+	albums := make([]albumEntry, len(c.Albums))
+	var items []item
+	for i, post := range c.Posts {
+		raw, _ := json.Marshal(post)
+		hash := hashJSON(raw)
+		posts[i] = postEntry{post.summary(), hash, docImageKeys(post.HTMLContent)}
+		items = append(items, item{postItemKey(hash), raw})
+	}
+	for i, album := range c.Albums {
+		raw, _ := json.Marshal(album)
+		hash := hashJSON(raw)
+		albums[i] = albumEntry{album.summary(), hash}
+		items = append(items, item{albumItemKey(hash), raw})
+	}
+	return posts, albums, items
+}
+
+// writeContent stores c under snapshot id. Items whose key is in stored are
+// already in the store and aren't written again, and the keys written are
+// added to it.
+func writeContent(st store.Store, id int, c content, stored map[string]bool) error {
+	posts, albums, items := indexContent(c)
+	for _, it := range items {
+		if stored[it.key] {
+			continue
+		}
+		if err := st.Put(it.key, string(it.raw), store.PutOptions{}); err != nil {
+			return fmt.Errorf("saving %s: %w", it.key, err)
+		}
+		stored[it.key] = true
+	}
+	if err := store.PutJSON(st, manifestKey(id), c.Manifest, store.PutOptions{}); err != nil {
+		return fmt.Errorf("saving blog_manifest: %w", err)
+	}
+	if err := store.PutJSON(st, photoIDsKey(id), photoIDs(c.Albums), store.PutOptions{}); err != nil {
+		return fmt.Errorf("saving photo_ids: %w", err)
+	}
+
+	// The indexes go last so they never list an item that isn't stored yet
+	if err := store.PutJSON(st, blogIndexKey(id), posts, store.PutOptions{}); err != nil {
+		return fmt.Errorf("saving blog_index: %w", err)
+	}
+	if err := store.PutJSON(st, cosplayIndexKey(id), albums, store.PutOptions{}); err != nil {
+		return fmt.Errorf("saving cosplay_index: %w", err)
+	}
+	return nil
+}
+
+// loadIndexes reads snapshot id's indexes, found is false when it has none.
+// When id is 0 they are built from the unversioned keys.
+func loadIndexes(st store.Store, id int) (posts []postEntry, albums []albumEntry, found bool, err error) {
+	if id == 0 {
+		c, err := loadLegacy(st)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		posts, albums, _ = indexContent(c)
+		return posts, albums, false, nil
+	}
+	if posts, found, err = store.GetJSON[[]postEntry](st, blogIndexKey(id)); err != nil || !found {
+		if err != nil {
+			err = fmt.Errorf("reading blog_index: %w", err)
+		}
+		return nil, nil, false, err
+	}
+	if albums, _, err = store.GetJSON[[]albumEntry](st, cosplayIndexKey(id)); err != nil {
+		return nil, nil, false, fmt.Errorf("reading cosplay_index: %w", err)
+	}
+	return posts, albums, true, nil
+}
+
+// loadContent reads all of snapshot id's content, or the unversioned keys
+// when id is 0
+func loadContent(st store.Store, id int) (content, error) {
+	if id == 0 {
+		return loadLegacy(st)
+	}
+	posts, found, err := store.GetJSON[[]postEntry](st, blogIndexKey(id))
+	if err != nil {
+		return content{}, fmt.Errorf("reading blog_index: %w", err)
+	}
+	if !found {
+		return content{}, nil
+	}
+	albums, _, err := store.GetJSON[[]albumEntry](st, cosplayIndexKey(id))
+	if err != nil {
+		return content{}, fmt.Errorf("reading cosplay_index: %w", err)
+	}
+
+	c := content{stored: map[string]bool{}}
+	for _, entry := range posts {
+		key := postItemKey(entry.Item)
+		post, err := loadItem[BlogPost](st, key)
+		if err != nil {
+			return c, fmt.Errorf("reading post %s: %w", entry.ID, err)
+		}
+		c.Posts = append(c.Posts, post)
+		c.stored[key] = true
+	}
+	for _, entry := range albums {
+		key := albumItemKey(entry.Item)
+		album, err := loadItem[CosplayAlbum](st, key)
+		if err != nil {
+			return c, fmt.Errorf("reading album %s: %w", entry.ID, err)
+		}
+		c.Albums = append(c.Albums, album)
+		c.stored[key] = true
+	}
+	if c.Manifest, _, err = store.GetJSON[BlogManifest](st, manifestKey(id)); err != nil {
+		return c, fmt.Errorf("reading blog_manifest: %w", err)
+	}
+	return c, nil
+}
+
+// loadItem reads an item an index points to, which has to exist
+func loadItem[T any](st store.Store, key string) (T, error) {
+	v, found, err := store.GetJSON[T](st, key)
+	if err == nil && !found {
+		err = fmt.Errorf("%s is missing", key)
+	}
+	return v, err
+}
+
+// loadLegacy reads content from the unversioned keys
+func loadLegacy(st store.Store) (content, error) {
+	var c content
+	var err error
+	if c.Posts, _, err = store.GetJSON[[]BlogPost](st, legacyBlogKey); err != nil {
+		return c, fmt.Errorf("reading blog_data: %w", err)
+	}
+	if c.Manifest, _, err = store.GetJSON[BlogManifest](st, legacyManifestKey); err != nil {
+		return c, fmt.Errorf("reading blog_manifest: %w", err)
+	}
+	if c.Albums, _, err = store.GetJSON[[]CosplayAlbum](st, legacyCosplayKey); err != nil {
+		return c, fmt.Errorf("reading cosplay_data: %w", err)
+	}
+	return c, nil
+}
+
+// itemKeys returns the keys of the items and Docs images snapshot id's
+// indexes point to
+func itemKeys(st store.Store, id int) (map[string]bool, error) {
+	posts, albums, found, err := loadIndexes(st, id)
+	if err != nil || !found {
+		return nil, err
+	}
+	keys := make(map[string]bool, len(posts)+len(albums))
+	for _, entry := range posts {
+		keys[postItemKey(entry.Item)] = true
+		for _, key := range entry.Images {
+			keys[docImageKeyPrefix+key] = true
+		}
+	}
+	for _, entry := range albums {
+		keys[albumItemKey(entry.Item)] = true
+	}
+	return keys, nil
+}
+
+// deleteContent removes snapshot id's own keys. Its items may be shared
+// with other snapshots; see deleteUnusedItems.
+func deleteContent(st store.Store, id int) error {
+	keys, err := store.ListAll(st, contentKeyPrefix(id))
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := st.Delete(k.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteUnusedItems deletes those of keys that no snapshot in kept points to
+func deleteUnusedItems(st store.Store, keys map[string]bool, kept map[int]bool) error {
+	for id := range kept {
+		used, err := itemKeys(st, id)
+		if err != nil {
+			return fmt.Errorf("snapshot %d: %w", id, err)
+		}
+		for key := range used {
+			delete(keys, key)
+		}
+	}
+	for key := range keys {
+		if err := st.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadPostIndex reads the live posts for listing, drafts included, without
+// their content
+func LoadPostIndex(st store.Store) []BlogPost {
+	id, err := CurrentSnapshot(st)
+	if err != nil {
+		fmt.Println("Error reading the current snapshot:", err)
+		return nil
+	}
+	entries, _, _, err := loadIndexes(st, id)
+	if err != nil {
+		fmt.Println("Error reading blog_index:", err)
+		return nil
+	}
+	posts := make([]BlogPost, len(entries))
+	for i, entry := range entries {
+		posts[i] = entry.BlogPost
+	}
+	return posts
+}
+
+// LoadPost reads one live post by slug, or by ID for posts without one.
+// Drafts are returned too; check Published before showing it.
+func LoadPost(st store.Store, slug string) (BlogPost, bool) {
+	id, err := CurrentSnapshot(st)
+	if err == nil && id == 0 {
+		// Not migrated yet, see MigrateContent
+		posts, _, err := store.GetJSON[[]BlogPost](st, legacyBlogKey)
+		if err != nil {
+			fmt.Println("Error reading blog_data:", err)
+		}
+		return FindPost(posts, slug)
+	}
+	var entries []postEntry
+	if err == nil {
+		entries, _, err = store.GetJSON[[]postEntry](st, blogIndexKey(id))
+	}
+	if err != nil {
+		fmt.Printf("Error reading post %s: %v\n", slug, err)
+		return BlogPost{}, false
+	}
+	for _, entry := range entries {
+		if entry.Slug == slug || (entry.Slug == "" && entry.ID == slug) {
+			post, err := loadItem[BlogPost](st, postItemKey(entry.Item))
+			if err != nil {
+				fmt.Printf("Error reading post %s: %v\n", slug, err)
+				return BlogPost{}, false
+			}
+			return post, true
+		}
+	}
+	return BlogPost{}, false
+}
+
+// LoadAlbumIndex reads the live albums for listing, without their photos
+func LoadAlbumIndex(st store.Store) []CosplayAlbum {
+	id, err := CurrentSnapshot(st)
+	if err != nil {
+		fmt.Println("Error reading the current snapshot:", err)
+		return nil
+	}
+	_, entries, _, err := loadIndexes(st, id)
+	if err != nil {
+		fmt.Println("Error reading cosplay_index:", err)
+		return nil
+	}
+	albums := make([]CosplayAlbum, len(entries))
+	for i, entry := range entries {
+		albums[i] = entry.CosplayAlbum
+	}
+	return albums
+}
+
+// LoadAlbum reads one live album with its photos
+func LoadAlbum(st store.Store, albumID string) (CosplayAlbum, bool) {
+	id, err := CurrentSnapshot(st)
+	if err == nil && id == 0 {
+		// Not migrated yet, see MigrateContent
+		albums, _, err := store.GetJSON[[]CosplayAlbum](st, legacyCosplayKey)
+		if err != nil {
+			fmt.Println("Error reading cosplay_data:", err)
+		}
+		for _, album := range albums {
+			if album.ID == albumID {
+				return album, true
+			}
+		}
+		return CosplayAlbum{}, false
+	}
+	var entries []albumEntry
+	if err == nil {
+		entries, _, err = store.GetJSON[[]albumEntry](st, cosplayIndexKey(id))
+	}
+	if err != nil {
+		fmt.Printf("Error reading album %s: %v\n", albumID, err)
+		return CosplayAlbum{}, false
+	}
+	for _, entry := range entries {
+		if entry.ID == albumID {
+			album, err := loadItem[CosplayAlbum](st, albumItemKey(entry.Item))
+			if err != nil {
+				fmt.Printf("Error reading album %s: %v\n", albumID, err)
+				return CosplayAlbum{}, false
+			}
+			return album, true
+		}
+	}
+	return CosplayAlbum{}, false
+}
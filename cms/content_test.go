@@ -0,0 +1,240 @@
+package cms
+
+import (
+	"cloudflare-worker-boilerplate/store"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingStore records the keys written to it
+type countingStore struct {
+	store.Store
+	puts []string
+}
+
+func (s *countingStore) Put(key, value string, opts store.PutOptions) error {
+	s.puts = append(s.puts, key)
+	return s.Store.Put(key, value, opts)
+}
+
+func (s *countingStore) itemPuts() []string {
+	var keys []string
+	for _, k := range s.puts {
+		if strings.HasPrefix(k, itemPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func TestSnapshotsShareItems(t *testing.T) {
+	st := &countingStore{Store: store.NewMemory()}
+	first := content{
+		Posts: []BlogPost{
+			{ID: "1", Slug: "one", Title: "One", HTMLContent: "<p>1</p>", Extra: map[string]any{"n": 3}, PublishAt: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)},
+			{ID: "2", Slug: "two", Title: "Two", HTMLContent: "<p>2</p>"},
+		},
+		Manifest: BlogManifest{"1": {Name: "one.md"}},
+		Albums:   []CosplayAlbum{{ID: "a1", Title: "Ahri", Images: []CosplayMedia{{ID: "m1", URL: PhotoProxyURL("m1")}}}},
+	}
+	snap, err := saveSnapshot(st, first, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publishSnapshot(st, snap.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(st.itemPuts()); got != 3 {
+		t.Fatalf("first snapshot wrote %d items, want 3", got)
+	}
+
+	// A sync that changes one post writes that post and the snapshot's own
+	// keys, nothing else
+	live, err := loadContent(st, snap.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := live
+	next.Posts = append([]BlogPost(nil), live.Posts...)
+	next.Posts[1].HTMLContent = "<p>2, edited</p>"
+	st.puts = nil
+	snap, err = saveSnapshot(st, next, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publishSnapshot(st, snap.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := st.itemPuts(); len(got) != 1 || !strings.HasPrefix(got[0], "item:post:") {
+		t.Errorf("second snapshot wrote items %v, want just the edited post", got)
+	}
+	if len(st.puts) > 8 {
+		t.Errorf("second snapshot made %d writes: %v", len(st.puts), st.puts)
+	}
+
+	post, ok := LoadPost(st, "two")
+	if !ok || post.HTMLContent != "<p>2, edited</p>" {
+		t.Errorf("LoadPost(two) = %+v, %v", post, ok)
+	}
+	if posts := LoadPostIndex(st); len(posts) != 2 || posts[0].HTMLContent != "" || posts[0].Slug != "one" {
+		t.Errorf("LoadPostIndex = %+v", posts)
+	}
+	album, ok := LoadAlbum(st, "a1")
+	if !ok || len(album.Images) != 1 {
+		t.Errorf("LoadAlbum(a1) = %+v, %v", album, ok)
+	}
+	if _, ok := LoadAlbum(st, "nope"); ok {
+		t.Error("LoadAlbum found an album that doesn't exist")
+	}
+
+	diff, err := DiffSnapshots(st, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ItemDiff{Changed: []DiffItem{{ID: "2", Name: "Two"}}}
+	if !reflect.DeepEqual(diff.Posts, want) || !reflect.DeepEqual(diff.Albums, ItemDiff{}) {
+		t.Errorf("diff = %+v", diff)
+	}
+
+	// Pruning snapshot 1 removes only the post version nothing else uses
+	before := itemKeysIn(t, st)
+	pruned, err := pruneSnapshots(st, 1, snap.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pruned, []int{1}) {
+		t.Fatalf("pruned %v, want [1]", pruned)
+	}
+	after := itemKeysIn(t, st)
+	if len(after) != len(before)-1 {
+		t.Errorf("items after pruning = %v, want one fewer than %v", after, before)
+	}
+	if _, err := loadContent(st, snap.ID); err != nil {
+		t.Errorf("live snapshot after pruning: %v", err)
+	}
+}
+
+func itemKeysIn(t *testing.T, st store.Store) []string {
+	t.Helper()
+	keys, err := store.ListAll(st, itemPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, k := range keys {
+		names = append(names, k.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// laggingList is a store whose listings leave out the keys in hidden, like a
+// Workers KV listing that has caught up with some writes but not others
+type laggingList struct {
+	store.Store
+	hidden map[string]bool
+}
+
+func (s laggingList) List(opts store.ListOptions) (store.ListResult, error) {
+	result, err := s.Store.List(opts)
+	if err != nil {
+		return result, err
+	}
+	keys := result.Keys[:0:0]
+	for _, k := range result.Keys {
+		if !s.hidden[k.Name] {
+			keys = append(keys, k)
+		}
+	}
+	result.Keys = keys
+	return result, nil
+}
+
+func TestPruneKeepsItemsOfUnlistedSnapshots(t *testing.T) {
+	st := laggingList{Store: store.NewMemory(), hidden: map[string]bool{}}
+	a := content{Posts: []BlogPost{{ID: "1", Slug: "one", Title: "One", HTMLContent: "<p>a</p>"}}}
+	b := content{Posts: []BlogPost{{ID: "1", Slug: "one", Title: "One", HTMLContent: "<p>b</p>"}}}
+
+	// Snapshot 3 goes back to snapshot 1's post, so they share its item,
+	// but the listing doesn't show snapshot 3 yet
+	var ids []int
+	for _, c := range []content{a, b, a} {
+		snap, err := saveSnapshot(st, c, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, snap.ID)
+	}
+	st.hidden[snapshotKey(ids[2])] = true
+	if err := publishSnapshot(st, ids[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pruneSnapshots(st, 1, ids[2]); err != nil {
+		t.Fatal(err)
+	}
+	post, ok := LoadPost(st, "one")
+	if !ok || post.HTMLContent != "<p>a</p>" {
+		t.Errorf("live post after pruning = %+v, %v", post, ok)
+	}
+
+	// The same goes for a staged snapshot the listing doesn't show yet,
+	// sharing an item with snapshot 2, which is pruned now
+	delete(st.hidden, snapshotKey(ids[2]))
+	snap, err := saveSnapshot(st, b, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.hidden[snapshotKey(snap.ID)] = true
+	pruned, err := pruneSnapshots(st, 1, snap.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pruned, []int{ids[1]}) {
+		t.Errorf("pruned %v, want [%d]", pruned, ids[1])
+	}
+	if _, err := loadContent(st, snap.ID); err != nil {
+		t.Errorf("staged snapshot after pruning: %v", err)
+	}
+}
+
+func TestPruneDeletesUnusedDocImages(t *testing.T) {
+	st := store.NewMemory()
+	old, kept := docImageKey([]byte("old")), docImageKey([]byte("kept"))
+	for _, key := range []string{old, kept} {
+		if err := st.Put(docImageKeyPrefix+key, "", store.PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	post := func(keys ...string) content {
+		html := ""
+		for _, key := range keys {
+			html += `<img src="` + docImagePath + key + `"/>`
+		}
+		return content{Posts: []BlogPost{{ID: "1", Slug: "one", HTMLContent: html}}}
+	}
+
+	// The doc is edited to replace one image, then the first version pruned
+	var snap Snapshot
+	for _, c := range []content{post(old, kept), post(kept)} {
+		var err error
+		if snap, err = saveSnapshot(st, c, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := publishSnapshot(st, snap.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := pruneSnapshots(st, 1, snap.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Get(docImageKeyPrefix + old); err == nil {
+		t.Error("image only the pruned snapshot linked is still stored")
+	}
+	if _, err := st.Get(docImageKeyPrefix + kept); err != nil {
+		t.Errorf("image the live snapshot links: %v", err)
+	}
+}
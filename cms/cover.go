@@ -0,0 +1,73 @@
+package cms
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// coverOverridesKey holds the CoverOverrides in KV
+const coverOverridesKey = "cosplay_cover_overrides"
+
+// CoverOverrides maps album IDs to a cover selector set by an admin. They are
+// stored on their own, outside any snapshot, and applied to every sync's
+// albums before they're saved as item:album:<hash> entries and listed in
+// content:<id>:cosplay_index, so a re-sync doesn't lose them. They win over
+// the album's own Cover: metadata. See SetCoverOverride for changing one.
+type CoverOverrides map[string]string
+
+// findMedia returns the index of the item picked by selector: a 1-based
+// position, a filename (case-insensitive) or a media ID
+func findMedia(media []CosplayMedia, selector string) (int, bool) {
+	selector = strings.TrimSpace(selector)
+	if n, err := strconv.Atoi(selector); err == nil {
+		if n >= 1 && n <= len(media) {
+			return n - 1, true
+		}
+		return 0, false
+	}
+	for i, m := range media {
+		if strings.EqualFold(m.Filename, selector) || (m.ID != "" && m.ID == selector) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// setCover makes the photo picked by selector the album's cover
+func setCover(album *CosplayAlbum, selector string) error {
+	i, ok := findMedia(album.Images, selector)
+	if !ok {
+		return fmt.Errorf("cover %q doesn't match any photo in the album", selector)
+	}
+	if album.Images[i].Kind == MediaVideo {
+		return fmt.Errorf("cover %q is a video", selector)
+	}
+	album.CoverImage = album.Images[i].URL
+	return nil
+}
+
+// applyCovers sets each album's cover from its override, or else from its
+// Cover: metadata. A selector that doesn't match falls through to the next
+// choice, ending at the default cover, and is reported as a warning.
+func applyCovers(albums []CosplayAlbum, overrides CoverOverrides) []ItemError {
+	var warnings []ItemError
+	for i := range albums {
+		album := &albums[i]
+		choices := []struct{ selector, source string }{
+			{overrides[album.ID], "cover override"},
+			{album.Cover, "Cover metadata"},
+		}
+		for _, choice := range choices {
+			if choice.selector == "" {
+				continue
+			}
+			err := setCover(album, choice.selector)
+			if err == nil {
+				break
+			}
+			warnings = append(warnings, ItemError{ID: album.ID, Name: album.Title, Message: choice.source + ": " + err.Error()})
+		}
+	}
+	return warnings
+}
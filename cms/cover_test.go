@@ -0,0 +1,63 @@
+package cms
+
+import (
+	"cloudflare-worker-boilerplate/store"
+	"errors"
+	"testing"
+)
+
+func TestSetCoverOverrideErrors(t *testing.T) {
+	st := store.NewMemory()
+	albums := []CosplayAlbum{{ID: "a1", Title: "Ahri", Images: []CosplayMedia{
+		{URL: "/gphoto/p1", Kind: MediaPhoto},
+		{URL: "/gphoto/v1?kind=video", Kind: MediaVideo},
+	}}}
+	if err := writeContent(st, 1, content{Albums: albums}, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := setCurrentSnapshot(st, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		albumID, selector string
+		wantInput         bool
+	}{
+		{"a1", "1", false},
+		{"a1", "", false},
+		{"missing", "1", true},
+		{"a1", "3", true},
+		{"a1", "2", true}, // a video
+	}
+	for _, tt := range tests {
+		err := SetCoverOverride(st, tt.albumID, tt.selector)
+		var inputErr *InputError
+		if got := errors.As(err, &inputErr); got != tt.wantInput || (!tt.wantInput && err != nil) {
+			t.Errorf("SetCoverOverride(%q, %q) = %v, want input error %v", tt.albumID, tt.selector, err, tt.wantInput)
+		}
+	}
+
+	// The cover went live as snapshot 2; snapshot 1 is as the sync left it
+	if id := mustCurrent(t, st); id != 2 {
+		t.Errorf("current snapshot = %d, want 2", id)
+	}
+	for id, want := range map[int]string{1: "", 2: "/gphoto/p1"} {
+		c, err := loadContent(st, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.Albums[0].CoverImage; got != want {
+			t.Errorf("snapshot %d cover = %q, want %q", id, got, want)
+		}
+	}
+
+	// A store that can't be read isn't the request's fault
+	if err := st.Put(coverOverridesKey, "{", store.PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err := SetCoverOverride(st, "a1", "1")
+	var inputErr *InputError
+	if err == nil || errors.As(err, &inputErr) {
+		t.Errorf("SetCoverOverride with unreadable overrides = %v, want a storage error", err)
+	}
+}
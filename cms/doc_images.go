@@ -0,0 +1,148 @@
+package cms
+
+import (
+	"cloudflare-worker-boilerplate/store"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Images embedded in a Google Doc are exported as links to Docs' own image
+// hosts, and those links stop working a while later. The sync downloads
+// each one and stores it in KV, base64 encoded, under a hash of its
+// content; the worker serves it from /gdocimage/<key>. Export URLs change
+// every time a doc is exported, the content doesn't, so an unchanged image
+// keeps its key. Images no snapshot links to any more are deleted with the
+// snapshots, see itemKeys.
+const (
+	docImageKeyPrefix = "gdoc_image:"
+	docImagePath      = "/gdocimage/"
+
+	// maxDocImageBytes keeps a stored image well under the KV value limit
+	// once base64 encoded
+	maxDocImageBytes = 10 << 20
+)
+
+var docImageHost = regexp.MustCompile(`^lh[0-9]*(-rt)?\.googleusercontent\.com$`)
+
+// isDocImageHost reports whether host is one Docs serves embedded images
+// from, e.g. lh3.googleusercontent.com or lh7-rt.googleusercontent.com.
+// Other googleusercontent.com hosts serve user content that isn't an image.
+func isDocImageHost(host string) bool {
+	return docImageHost.MatchString(host)
+}
+
+// docImage is an image referenced by a doc, downloaded during the sync.
+// Until then Key is a stand-in made from Src.
+type docImage struct {
+	Key         string
+	Src         string
+	ContentType string
+	Data        []byte
+}
+
+// DocImage is a stored Google Doc image
+type DocImage struct {
+	ContentType string
+	Data        []byte
+}
+
+func docImageKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+var docImageLink = regexp.MustCompile(regexp.QuoteMeta(docImagePath) + `([0-9a-f]{32})`)
+
+// docImageKeys returns the keys of the stored images html links to
+func docImageKeys(html string) []string {
+	var keys []string
+	for _, m := range docImageLink.FindAllStringSubmatch(html, -1) {
+		keys = append(keys, m[1])
+	}
+	return keys
+}
+
+// downloadDocImages fetches the images on Docs' hosts that post links to
+// and points the links at their content keys
+func (c *DriveClient) downloadDocImages(post *BlogPost) error {
+	for i := range post.docImages {
+		img := &post.docImages[i]
+		if err := c.downloadDocImage(img); err != nil {
+			return fmt.Errorf("downloading image %s: %w", img.Src, err)
+		}
+		key := docImageKey(img.Data)
+		post.HTMLContent = strings.ReplaceAll(post.HTMLContent, docImagePath+img.Key, docImagePath+key)
+		img.Key = key
+	}
+	return nil
+}
+
+func (c *DriveClient) downloadDocImage(img *docImage) error {
+	resp, err := c.Retry.do(c.HTTP, func() (*http.Request, error) {
+		return http.NewRequest("GET", img.Src, nil)
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(contentType, "image/") {
+		return fmt.Errorf("not an image: %q", contentType)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDocImageBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxDocImageBytes {
+		return fmt.Errorf("larger than %d MiB", maxDocImageBytes>>20)
+	}
+	img.ContentType, img.Data = contentType, data
+	return nil
+}
+
+// saveDocImages stores the images downloaded for posts. Only docs exported
+// again by this sync have any; an image that didn't change is written over
+// itself.
+func saveDocImages(st store.Store, posts []BlogPost) error {
+	for _, post := range posts {
+		for _, img := range post.docImages {
+			opts := store.PutOptions{Metadata: map[string]any{"content_type": img.ContentType}}
+			if err := st.Put(docImageKeyPrefix+img.Key, base64.StdEncoding.EncodeToString(img.Data), opts); err != nil {
+				return fmt.Errorf("saving image for post %s: %w", post.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadDocImage reads an image stored by the sync, served at /gdocimage/<key>
+func LoadDocImage(st store.Store, key string) (DocImage, bool, error) {
+	entry, err := st.GetWithMetadata(docImageKeyPrefix + key)
+	if errors.Is(err, store.ErrNotFound) {
+		return DocImage{}, false, nil
+	}
+	if err != nil {
+		return DocImage{}, false, err
+	}
+	data, err := base64.StdEncoding.DecodeString(entry.Value)
+	if err != nil {
+		return DocImage{}, false, fmt.Errorf("decoding image %s: %w", key, err)
+	}
+	contentType, _ := entry.Metadata["content_type"].(string)
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = "application/octet-stream"
+	}
+	return DocImage{ContentType: contentType, Data: data}, true, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
@@ -12,64 +13,172 @@ type DriveFile struct {
 	ID       string `json:"id"`
 	Name     string `json:"name"`
 	MimeType string `json:"mimeType"`
+
+	// Change detection for incremental sync. Google Docs have no checksum,
+	// only a modifiedTime.
+	ModifiedTime string `json:"modifiedTime"`
+	Md5Checksum  string `json:"md5Checksum"`
+
+	// Category is the name of the subfolder the file was found in,
+	// empty for files directly inside the root folder.
+	Category string `json:"-"`
+
+	// Used for cosplay album folders
+	Description        string              `json:"description"`
+	ImageMediaMetadata *DriveImageMetadata `json:"imageMediaMetadata"`
+	VideoMediaMetadata *DriveVideoMetadata `json:"videoMediaMetadata"`
+}
+
+type DriveImageMetadata struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Time   string `json:"time"` // EXIF date, "2006:01:02 15:04:05"
+}
+
+type DriveVideoMetadata struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
 }
 
 type DriveListResponse struct {
-	Files []DriveFile `json:"files"`
+	Files         []DriveFile `json:"files"`
+	NextPageToken string      `json:"nextPageToken"`
 }
 
-func FetchBlogPosts(folderID, apiKey string) ([]BlogPost, error) {
-	// 1. List files in folder
-	url := fmt.Sprintf("https://www.googleapis.com/drive/v3/files?q='%s'+in+parents&key=%s", folderID, apiKey)
-	resp, err := http.Get(url)
+const driveFolderMimeType = "application/vnd.google-apps.folder"
+
+// FetchBlogPosts downloads every post in the folder, ignoring any cached state
+func (c *DriveClient) FetchBlogPosts(folderID string) ([]BlogPost, error) {
+	result, err := c.SyncBlogPosts(folderID, nil, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return result.Posts, nil
+}
 
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("google drive api error: %s", string(body))
+// fetchBlogPost downloads and parses a single Drive file
+func (c *DriveClient) fetchBlogPost(file DriveFile) (BlogPost, error) {
+	content, err := c.downloadFileContent(file.ID, file.MimeType)
+	if err != nil {
+		return BlogPost{}, err
 	}
 
-	var list DriveListResponse
-	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
-		return nil, err
+	var post BlogPost
+	if isGoogleDoc(file.MimeType) {
+		post, err = parseGoogleDoc(file.ID, content)
+	} else {
+		post, err = parseBlogPost(file.ID, content)
 	}
+	if err != nil {
+		return BlogPost{}, &ParseError{FileID: file.ID, FileName: file.Name, Err: err}
+	}
+	if err := c.downloadDocImages(&post); err != nil {
+		return BlogPost{}, err
+	}
+	// Subfolder acts as the category unless the doc sets its own Type:
+	if post.Type == "" {
+		post.Type = file.Category
+	}
+	return post, nil
+}
 
-	var posts []BlogPost
+// listFolderRecursive walks folderID and every nested subfolder, returning all
+// non-folder files. Each file's Category is the name of its closest parent
+// folder below the root.
+func (c *DriveClient) listFolderRecursive(folderID string) ([]DriveFile, error) {
+	type pending struct {
+		id       string
+		category string
+	}
 
-	// 2. Fetch content for each file
-	for _, file := range list.Files {
-		// Only process text files or google docs
-		if strings.Contains(file.MimeType, "folder") {
-			continue
+	var files []DriveFile
+	queue := []pending{{id: folderID}}
+	visited := map[string]bool{folderID: true}
+
+	for len(queue) > 0 {
+		folder := queue[0]
+		queue = queue[1:]
+
+		children, err := c.listFolder(folder.id)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, child := range children {
+			if child.MimeType == driveFolderMimeType {
+				// A folder with several parents can be listed more than once
+				if !visited[child.ID] {
+					visited[child.ID] = true
+					queue = append(queue, pending{id: child.ID, category: child.Name})
+				}
+				continue
+			}
+			child.Category = folder.category
+			files = append(files, child)
 		}
+	}
+
+	return files, nil
+}
+
+// listFolder returns the direct children of a folder, following nextPageToken
+// until the whole listing has been read.
+func (c *DriveClient) listFolder(folderID string) ([]DriveFile, error) {
+	var files []DriveFile
+	pageToken := ""
 
-		content, err := downloadFileContent(file.ID, file.MimeType, apiKey)
+	for {
+		params := url.Values{}
+		params.Set("q", fmt.Sprintf("'%s' in parents and trashed = false", escapeDriveQuery(folderID)))
+		params.Set("fields", "nextPageToken,files(id,name,mimeType,modifiedTime,md5Checksum,description,imageMediaMetadata(width,height,time),videoMediaMetadata(width,height))")
+		params.Set("pageSize", "1000")
+		if pageToken != "" {
+			params.Set("pageToken", pageToken)
+		}
+
+		resp, err := c.get("/drive/v3/files", params)
 		if err != nil {
-			fmt.Printf("Error fetching file %s: %v\n", file.Name, err)
-			continue
+			return nil, err
 		}
 
-		post := parseBlogPost(file.ID, content)
-		posts = append(posts, post)
+		if resp.StatusCode != 200 {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("google drive api error: %s", string(body))
+		}
+
+		var list DriveListResponse
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, list.Files...)
+
+		if list.NextPageToken == "" {
+			return files, nil
+		}
+		pageToken = list.NextPageToken
 	}
+}
 
-	return posts, nil
+// escapeDriveQuery escapes a value for a single-quoted string in a Drive
+// search query
+func escapeDriveQuery(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
 }
 
-func downloadFileContent(fileID, mimeType, apiKey string) (string, error) {
-	var url string
-	if strings.Contains(mimeType, "google-apps.document") {
-		// Export Google Docs as text/plain for easier parsing, or text/html
-		url = fmt.Sprintf("https://www.googleapis.com/drive/v3/files/%s/export?mimeType=text/plain&key=%s", fileID, apiKey)
+func (c *DriveClient) downloadFileContent(fileID, mimeType string) (string, error) {
+	var resp *http.Response
+	var err error
+	if isGoogleDoc(mimeType) {
+		// Export Google Docs as HTML to keep formatting and images; see gdoc.go
+		resp, err = c.get("/drive/v3/files/"+url.PathEscape(fileID)+"/export", url.Values{"mimeType": {"text/html"}})
 	} else {
 		// Download raw content for other types
-		url = fmt.Sprintf("https://www.googleapis.com/drive/v3/files/%s?alt=media&key=%s", fileID, apiKey)
+		resp, err = c.get("/drive/v3/files/"+url.PathEscape(fileID), url.Values{"alt": {"media"}})
 	}
-
-	resp, err := http.Get(url)
 	if err != nil {
 		return "", err
 	}
@@ -87,14 +196,25 @@ func downloadFileContent(fileID, mimeType, apiKey string) (string, error) {
 	return string(bytes), nil
 }
 
-func parseBlogPost(id, content string) BlogPost {
+func parseBlogPost(id, content string) (BlogPost, error) {
 	post := BlogPost{
 		ID:          id,
-		Title:       "Untitled",
 		HTMLContent: "",
 	}
 
-	// Simple metadata parser
+	// YAML/TOML front matter, see frontmatter.go
+	if fence, meta, body, ok := splitFrontMatter(content); ok {
+		fields, err := decodeFrontMatter(fence, meta)
+		if err != nil {
+			return post, err
+		}
+		if err := applyFrontMatter(&post, fields); err != nil {
+			return post, err
+		}
+		return renderPostBody(post, body)
+	}
+
+	// Legacy metadata header
 	// Format:
 	// Title: ...
 	// Date: ...
@@ -102,53 +222,67 @@ func parseBlogPost(id, content string) BlogPost {
 	// ---
 	// Content...
 
-	lines := strings.Split(content, "\n")
-	var bodyLines []string
-	inBody := false
+	headerLines, bodyLines, ok := splitLegacyHeader(strings.Split(content, "\n"))
 
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if !inBody {
-			if trimmed == "---" {
-				inBody = true
-				continue
-			}
-			if strings.HasPrefix(trimmed, "Title:") {
-				post.Title = strings.TrimSpace(strings.TrimPrefix(trimmed, "Title:"))
-			} else if strings.HasPrefix(trimmed, "Date:") {
-				post.Date = strings.TrimSpace(strings.TrimPrefix(trimmed, "Date:"))
-			} else if strings.HasPrefix(trimmed, "Type:") {
-				post.Type = strings.TrimSpace(strings.TrimPrefix(trimmed, "Type:"))
-			} else if strings.HasPrefix(trimmed, "Image:") {
-				post.ImageURL = strings.TrimSpace(strings.TrimPrefix(trimmed, "Image:"))
-			} else if strings.HasPrefix(trimmed, "Summary:") {
-				post.Summary = strings.TrimSpace(strings.TrimPrefix(trimmed, "Summary:"))
-			} else if strings.HasPrefix(trimmed, "Tags:") {
-				tagsRaw := strings.TrimPrefix(trimmed, "Tags:")
-				for _, t := range strings.Split(tagsRaw, ",") {
-					post.Tags = append(post.Tags, strings.TrimSpace(t))
-				}
-			}
-		} else {
-			bodyLines = append(bodyLines, line)
+	// Without a header closed by "---" the whole file is the body. Lines at
+	// the top that look like metadata still count, but a value that doesn't
+	// parse is ignored: "Status: feeling great" may just be a sentence.
+	if !ok {
+		for _, line := range headerLines {
+			applyMetadataLine(&post, line)
 		}
+		if post.Title == "" {
+			post.Title = "Untitled"
+		}
+		return renderPostBody(post, content)
 	}
 
-	// If no metadata separator found, treat whole file as body
-	if !inBody && len(bodyLines) == 0 {
-		post.HTMLContent = content
-	} else {
-		// Convert body lines to HTML paragraphs (very basic markdown-ish)
-		// In a real app we'd use a markdown parser library
-		var htmlBuilder strings.Builder
-		for _, line := range bodyLines {
-			if strings.TrimSpace(line) == "" {
-				continue
+	for _, line := range headerLines {
+		key, value, _ := splitMetadataLine(line)
+		known, err := setPostField(&post, key, value)
+		if err != nil {
+			return post, err
+		}
+		if !known {
+			if post.Extra == nil {
+				post.Extra = map[string]any{}
 			}
-			htmlBuilder.WriteString("<p>" + line + "</p>")
+			post.Extra[key] = value
+		}
+	}
+	if post.Title == "" {
+		return post, errMissingTitle
+	}
+
+	return renderPostBody(post, strings.Join(bodyLines, "\n"))
+}
+
+// splitLegacyHeader splits off the "Key: value" lines at the top of a file.
+// ok is true only when they are closed by a "---" line, which then starts
+// the body; a "---" after anything else is a Markdown horizontal rule.
+func splitLegacyHeader(lines []string) (header, body []string, ok bool) {
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "---" {
+			return header, lines[i+1:], len(header) > 0
+		}
+		if trimmed == "" {
+			continue
 		}
-		post.HTMLContent = htmlBuilder.String()
+		if _, _, isMeta := splitMetadataLine(trimmed); !isMeta {
+			return header, nil, false
+		}
+		header = append(header, trimmed)
 	}
+	return header, nil, false
+}
 
-	return post
+// renderPostBody renders the Markdown body into post.HTMLContent
+func renderPostBody(post BlogPost, body string) (BlogPost, error) {
+	html, err := renderMarkdown(body)
+	if err != nil {
+		return post, fmt.Errorf("rendering markdown: %w", err)
+	}
+	post.HTMLContent = html
+	return post, nil
 }
@@ -0,0 +1,109 @@
+package cms
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// albumMetadataFile is the optional file in an album folder holding
+// Photographer:/Assistant:/Location:/Description:/Cover:/Event:/Date: lines
+const albumMetadataFile = "album.txt"
+
+// FetchCosplayAlbums builds cosplay albums from a Drive folder. Every
+// subfolder is an album named "Title | Series", its images and videos sorted
+// by file name are the photos, and an optional album.txt holds the metadata.
+// Images are served through the worker's /gdrivephoto/ proxy, so the files
+// only need to be shared with "anyone with the link".
+func (c *DriveClient) FetchCosplayAlbums(folderID string) (AlbumSync, error) {
+	children, err := c.listFolder(folderID)
+	if err != nil {
+		return AlbumSync{}, err
+	}
+
+	var result AlbumSync
+	for _, child := range children {
+		if child.MimeType != driveFolderMimeType {
+			continue
+		}
+		album, err := c.fetchCosplayAlbum(child)
+		if err != nil {
+			result.Errors = append(result.Errors, &AlbumError{AlbumID: child.ID, Title: child.Name, Err: err})
+			continue
+		}
+		result.Albums = append(result.Albums, album)
+	}
+
+	return result, nil
+}
+
+// fetchCosplayAlbum reads one album folder
+func (c *DriveClient) fetchCosplayAlbum(folder DriveFile) (CosplayAlbum, error) {
+	files, err := c.listFolder(folder.ID)
+	if err != nil {
+		return CosplayAlbum{}, err
+	}
+
+	album := CosplayAlbum{ID: folder.ID}
+	parseAlbumTitle(folder.Name, &album)
+
+	var media []DriveFile
+	for _, f := range files {
+		switch {
+		case strings.EqualFold(f.Name, albumMetadataFile):
+			desc, err := c.downloadFileContent(f.ID, f.MimeType)
+			if err != nil {
+				return CosplayAlbum{}, fmt.Errorf("reading %s: %w", f.Name, err)
+			}
+			parseMetadataFromDescription(desc, &album)
+		case strings.HasPrefix(f.MimeType, "image/"), strings.HasPrefix(f.MimeType, "video/"):
+			media = append(media, f)
+		}
+	}
+
+	if len(media) == 0 {
+		return CosplayAlbum{}, fmt.Errorf("album folder %q has no images", folder.Name)
+	}
+
+	// Photos are ordered by file name so 01.jpg, 02.jpg... controls the order
+	sort.SliceStable(media, func(i, j int) bool {
+		return strings.ToLower(media[i].Name) < strings.ToLower(media[j].Name)
+	})
+
+	for _, f := range media {
+		album.Images = append(album.Images, driveMedia(f))
+	}
+	album.CoverImage = coverURL(album.Images)
+	fillAltText(&album)
+
+	return album, nil
+}
+
+// exifTimeLayout is how Drive reports when a photo was taken
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// driveMedia converts an image or video file to the stored album model
+func driveMedia(f DriveFile) CosplayMedia {
+	m := CosplayMedia{
+		ID:       f.ID,
+		URL:      "/gdrivephoto/" + url.PathEscape(f.ID),
+		Kind:     MediaPhoto,
+		Caption:  strings.TrimSpace(f.Description),
+		Filename: f.Name,
+	}
+	if strings.HasPrefix(f.MimeType, "video/") {
+		m.Kind = MediaVideo
+	}
+	if meta := f.ImageMediaMetadata; meta != nil {
+		m.Width, m.Height = meta.Width, meta.Height
+		if t, err := time.Parse(exifTimeLayout, meta.Time); err == nil {
+			m.TakenAt = t
+		}
+	}
+	if meta := f.VideoMediaMetadata; meta != nil {
+		m.Width, m.Height = meta.Width, meta.Height
+	}
+	return m
+}
@@ -0,0 +1,231 @@
+package cms
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Facet keys, also used as the /cosplays query parameters
+const (
+	FacetSeries       = "series"
+	FacetPhotographer = "photographer"
+	FacetLocation     = "location"
+	FacetEvent        = "event"
+	FacetYear         = "year"
+)
+
+// facetKeys lists the facets in display order
+var facetKeys = []string{FacetSeries, FacetPhotographer, FacetLocation, FacetEvent, FacetYear}
+
+var facetLabels = map[string]string{
+	FacetSeries:       "Series",
+	FacetPhotographer: "Photographer",
+	FacetLocation:     "Location",
+	FacetEvent:        "Event",
+	FacetYear:         "Year",
+}
+
+// AlbumFilter selects albums on /cosplays. An empty value matches anything.
+type AlbumFilter map[string]string
+
+// ParseAlbumFilter reads the facet parameters from a query string such as
+// "?series=Genshin+Impact&year=2024". Unknown parameters are ignored.
+func ParseAlbumFilter(rawQuery string) AlbumFilter {
+	values, _ := url.ParseQuery(strings.TrimPrefix(rawQuery, "?"))
+	f := AlbumFilter{}
+	for _, key := range facetKeys {
+		if v := strings.TrimSpace(values.Get(key)); v != "" {
+			f[key] = v
+		}
+	}
+	return f
+}
+
+// Active reports whether any facet is selected
+func (f AlbumFilter) Active() bool {
+	return len(f) > 0
+}
+
+// Query encodes the filter as a query string, "" when nothing is selected
+func (f AlbumFilter) Query() string {
+	values := url.Values{}
+	for key, v := range f {
+		values.Set(key, v)
+	}
+	return values.Encode()
+}
+
+// Toggle returns a copy of the filter with key set to value, or with key
+// cleared if it was already set to value
+func (f AlbumFilter) Toggle(key, value string) AlbumFilter {
+	out := AlbumFilter{}
+	for k, v := range f {
+		out[k] = v
+	}
+	if strings.EqualFold(out[key], value) {
+		delete(out, key)
+	} else {
+		out[key] = value
+	}
+	return out
+}
+
+// Match reports whether the album has every selected facet value
+func (f AlbumFilter) Match(album CosplayAlbum) bool {
+	return f.matchExcept(album, "")
+}
+
+// matchExcept is Match ignoring one facet, used to count that facet's values
+func (f AlbumFilter) matchExcept(album CosplayAlbum, skip string) bool {
+	for key, want := range f {
+		if key == skip {
+			continue
+		}
+		if !strings.EqualFold(facetValue(album, key), want) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterAlbums returns the albums matching f, keeping their order
+func FilterAlbums(albums []CosplayAlbum, f AlbumFilter) []CosplayAlbum {
+	if !f.Active() {
+		return albums
+	}
+	var out []CosplayAlbum
+	for _, album := range albums {
+		if f.Match(album) {
+			out = append(out, album)
+		}
+	}
+	return out
+}
+
+// Year is the year the album was shot, see ShotAt, or 0 when unknown
+func (a CosplayAlbum) Year() int {
+	if t := a.ShotAt(); !t.IsZero() {
+		return t.Year()
+	}
+	return 0
+}
+
+func facetValue(album CosplayAlbum, key string) string {
+	switch key {
+	case FacetSeries:
+		return album.Series
+	case FacetPhotographer:
+		return album.Photographer
+	case FacetLocation:
+		return album.Location
+	case FacetEvent:
+		return album.Event
+	case FacetYear:
+		if y := album.Year(); y != 0 {
+			return strconv.Itoa(y)
+		}
+	}
+	return ""
+}
+
+// Facet is one group of filter chips
+type Facet struct {
+	Key    string
+	Label  string
+	Values []FacetValue
+}
+
+// FacetValue is a single chip. Count is the number of albums it would show
+// given the other selected facets, and Filter is the filter after clicking it.
+type FacetValue struct {
+	Value  string
+	Count  int
+	Active bool
+	Filter AlbumFilter
+}
+
+// AlbumFacets works out the chips for every facet that has values. Each
+// facet is counted against the albums matching the other selected facets,
+// so picking a series still shows the other series as alternatives.
+func AlbumFacets(albums []CosplayAlbum, f AlbumFilter) []Facet {
+	var facets []Facet
+	for _, key := range facetKeys {
+		counts := map[string]int{}
+		names := map[string]string{} // first spelling seen of each value
+		for _, album := range albums {
+			v := facetValue(album, key)
+			if v == "" || !f.matchExcept(album, key) {
+				continue
+			}
+			norm := strings.ToLower(v)
+			if _, ok := names[norm]; !ok {
+				names[norm] = v
+			}
+			counts[norm]++
+		}
+		// Keep a selected value visible even when nothing matches it
+		if selected, ok := f[key]; ok {
+			if _, seen := names[strings.ToLower(selected)]; !seen {
+				names[strings.ToLower(selected)] = selected
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+
+		facet := Facet{Key: key, Label: facetLabels[key]}
+		for norm, v := range names {
+			facet.Values = append(facet.Values, FacetValue{
+				Value:  v,
+				Count:  counts[norm],
+				Active: strings.EqualFold(f[key], v),
+				Filter: f.Toggle(key, v),
+			})
+		}
+		sort.Slice(facet.Values, func(i, j int) bool {
+			a, b := facet.Values[i], facet.Values[j]
+			if key == FacetYear {
+				return a.Value > b.Value // newest first
+			}
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+			return strings.ToLower(a.Value) < strings.ToLower(b.Value)
+		})
+		facets = append(facets, facet)
+	}
+	return facets
+}
+
+// SeriesCount is one row of the series index
+type SeriesCount struct {
+	Series string
+	Count  int
+}
+
+// SeriesIndex lists every series with its album count, alphabetically.
+// Albums without a series are left out.
+func SeriesIndex(albums []CosplayAlbum) []SeriesCount {
+	counts := map[string]*SeriesCount{}
+	for _, album := range albums {
+		if album.Series == "" {
+			continue
+		}
+		norm := strings.ToLower(album.Series)
+		if counts[norm] == nil {
+			counts[norm] = &SeriesCount{Series: album.Series}
+		}
+		counts[norm].Count++
+	}
+
+	index := make([]SeriesCount, 0, len(counts))
+	for _, c := range counts {
+		index = append(index, *c)
+	}
+	sort.Slice(index, func(i, j int) bool {
+		return strings.ToLower(index[i].Series) < strings.ToLower(index[j].Series)
+	})
+	return index
+}
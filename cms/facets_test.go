@@ -0,0 +1,75 @@
+package cms
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAlbumFilter(t *testing.T) {
+	tests := []struct {
+		query string
+		want  AlbumFilter
+	}{
+		{"", AlbumFilter{}},
+		{"?series=Genshin+Impact&year=2024", AlbumFilter{FacetSeries: "Genshin Impact", FacetYear: "2024"}},
+		{"series=Genshin%20Impact", AlbumFilter{FacetSeries: "Genshin Impact"}},
+		{"?photographer=+Sam+&event=", AlbumFilter{FacetPhotographer: "Sam"}},
+		{"?location=Tokyo&location=Osaka", AlbumFilter{FacetLocation: "Tokyo"}},
+		{"?page=2&sort=new", AlbumFilter{}},
+		{"?series=%zz&event=Anime+Expo", AlbumFilter{FacetEvent: "Anime Expo"}},
+	}
+	for _, tt := range tests {
+		got := ParseAlbumFilter(tt.query)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseAlbumFilter(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+		if got.Active() != (len(tt.want) > 0) {
+			t.Errorf("ParseAlbumFilter(%q).Active() = %v", tt.query, got.Active())
+		}
+	}
+}
+
+func TestAlbumFilterRoundTrip(t *testing.T) {
+	f := AlbumFilter{FacetSeries: "Genshin Impact", FacetYear: "2024"}
+	if got := ParseAlbumFilter(f.Query()); !reflect.DeepEqual(got, f) {
+		t.Errorf("ParseAlbumFilter(%q) = %v, want %v", f.Query(), got, f)
+	}
+
+	toggled := f.Toggle(FacetYear, "2024")
+	if !reflect.DeepEqual(toggled, AlbumFilter{FacetSeries: "Genshin Impact"}) {
+		t.Errorf("Toggle off = %v", toggled)
+	}
+	if toggled = f.Toggle(FacetYear, "2023"); toggled[FacetYear] != "2023" {
+		t.Errorf("Toggle to another value = %v", toggled)
+	}
+	if f[FacetYear] != "2024" {
+		t.Error("Toggle changed the original filter")
+	}
+}
+
+func TestFilterAlbums(t *testing.T) {
+	albums := []CosplayAlbum{
+		{ID: "1", Series: "Genshin Impact", Photographer: "Sam", Date: "2024-05-01"},
+		{ID: "2", Series: "genshin impact", Date: "2023"},
+		{ID: "3", Series: "League of Legends", Photographer: "Sam"},
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"1", "2", "3"}},
+		{"series=Genshin+Impact", []string{"1", "2"}},
+		{"series=Genshin+Impact&year=2024", []string{"1"}},
+		{"photographer=sam", []string{"1", "3"}},
+		{"year=2022", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, a := range FilterAlbums(albums, ParseAlbumFilter(tt.query)) {
+			got = append(got, a.ID)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FilterAlbums(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package cms
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Posts can describe themselves in three ways:
+//
+//	---              +++                Title: ...
+//	title: ...       title = "..."      Date: ...
+//	tags: [a, b]     tags = ["a", "b"]  ---
+//	---              +++                Content...
+//	Content...       Content...
+//
+// YAML and TOML front matter decode into the known BlogPost fields, anything
+// else ends up in BlogPost.Extra. The legacy "Key: value" header is still
+// accepted, with keys matched case-insensitively.
+
+// ParseError is returned for a Drive file whose metadata could not be read.
+// The sync report lists these so a broken post doesn't just vanish.
+type ParseError struct {
+	FileID   string
+	FileName string
+	Err      error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s (%s): %v", e.FileName, e.FileID, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+var errMissingTitle = errors.New("metadata has no title")
+
+const (
+	yamlFence = "---"
+	tomlFence = "+++"
+)
+
+// splitFrontMatter separates a leading ---/+++ fenced block from the body.
+// ok is false when the content doesn't open with a fence line.
+func splitFrontMatter(content string) (fence, meta, body string, ok bool) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	lines := strings.Split(content, "\n")
+
+	first := 0
+	for first < len(lines) && strings.TrimSpace(lines[first]) == "" {
+		first++
+	}
+	if first == len(lines) {
+		return "", "", "", false
+	}
+	fence = strings.TrimSpace(lines[first])
+	if fence != yamlFence && fence != tomlFence {
+		return "", "", "", false
+	}
+
+	for i := first + 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == fence {
+			meta = strings.Join(lines[first+1:i], "\n")
+			body = strings.Join(lines[i+1:], "\n")
+			return fence, meta, body, true
+		}
+	}
+	return "", "", "", false
+}
+
+// decodeFrontMatter decodes a YAML (---) or TOML (+++) block into a map
+func decodeFrontMatter(fence, raw string) (map[string]any, error) {
+	fields := map[string]any{}
+	switch fence {
+	case yamlFence:
+		if err := yaml.Unmarshal([]byte(raw), &fields); err != nil {
+			return nil, fmt.Errorf("invalid YAML front matter: %w", err)
+		}
+	case tomlFence:
+		if _, err := toml.Decode(raw, &fields); err != nil {
+			return nil, fmt.Errorf("invalid TOML front matter: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown front matter fence %q", fence)
+	}
+	return fields, nil
+}
+
+// applyFrontMatter copies decoded front matter onto post. Keys are matched
+// case-insensitively; unknown keys are kept in post.Extra.
+func applyFrontMatter(post *BlogPost, fields map[string]any) error {
+	for key, value := range fields {
+		known, err := setPostField(post, key, value)
+		if err != nil {
+			return err
+		}
+		if !known {
+			if post.Extra == nil {
+				post.Extra = map[string]any{}
+			}
+			post.Extra[key] = value
+		}
+	}
+	if post.Title == "" {
+		return errMissingTitle
+	}
+	return nil
+}
+
+// applyMetadataLine sets the BlogPost field named by a "Key: value" header
+// line and reports whether the line was recognised. A recognised key with an
+// invalid value (e.g. "Status: drafty") is an error rather than ignored, so a
+// typo can't publish a draft.
+func applyMetadataLine(post *BlogPost, line string) (bool, error) {
+	key, value, ok := splitMetadataLine(line)
+	if !ok {
+		return false, nil
+	}
+	return setPostField(post, key, value)
+}
+
+// splitMetadataLine splits "Key: value", dropping quotes around the value
+func splitMetadataLine(line string) (key, value string, ok bool) {
+	key, value, ok = strings.Cut(line, ":")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" || strings.ContainsAny(key, " \t") {
+		return "", "", false
+	}
+	value = strings.TrimSpace(value)
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		value = value[1 : len(value)-1]
+	}
+	return key, value, true
+}
+
+// setPostField assigns one metadata value, reporting whether key is a
+// BlogPost field
+func setPostField(post *BlogPost, key string, value any) (bool, error) {
+	var target *string
+	switch strings.ToLower(key) {
+	case "title":
+		target = &post.Title
+	case "date":
+		target = &post.Date
+	case "type", "category":
+		target = &post.Type
+	case "image", "image_url", "cover":
+		target = &post.ImageURL
+	case "summary", "description":
+		target = &post.Summary
+	case "slug":
+		target = &post.Slug
+	case "status":
+		status, err := stringValue(value)
+		if err != nil {
+			return true, fmt.Errorf("field %q: %w", key, err)
+		}
+		status = strings.ToLower(strings.TrimSpace(status))
+		if status != StatusDraft && status != StatusPublished {
+			return true, fmt.Errorf("field %q: must be %q or %q, got %q", key, StatusDraft, StatusPublished, status)
+		}
+		post.Status = status
+		return true, nil
+	case "publishat", "publish_at", "publish-at":
+		t, err := timeValue(value)
+		if err != nil {
+			return true, fmt.Errorf("field %q: %w", key, err)
+		}
+		post.PublishAt = t
+		return true, nil
+	case "tags":
+		tags, err := stringList(value)
+		if err != nil {
+			return true, fmt.Errorf("field %q: %w", key, err)
+		}
+		post.Tags = tags
+		return true, nil
+	default:
+		return false, nil
+	}
+
+	s, err := stringValue(value)
+	if err != nil {
+		return true, fmt.Errorf("field %q: %w", key, err)
+	}
+	*target = strings.TrimSpace(s)
+	return true, nil
+}
+
+// stringValue accepts the scalar types YAML and TOML decode to
+func stringValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 {
+			return v.Format("2006-01-02"), nil
+		}
+		return v.Format(time.RFC3339), nil
+	case int, int64, float64, bool:
+		return fmt.Sprint(v), nil
+	case fmt.Stringer:
+		// toml.LocalDate, toml.LocalDateTime, ...
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("expected a single value, got %T", v)
+	}
+}
+
+// publishTimeLayouts are tried in order for string PublishAt values.
+// Times without a zone are UTC.
+var publishTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// timeValue accepts a YAML/TOML timestamp or one of publishTimeLayouts
+func timeValue(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return v, nil
+	}
+
+	s, err := stringValue(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range publishTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised time %q, use YYYY-MM-DD or RFC 3339", s)
+}
+
+// stringList accepts either a list or a comma separated string
+func stringList(v any) ([]string, error) {
+	var raw []string
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		raw = strings.Split(v, ",")
+	case []any:
+		for _, item := range v {
+			s, err := stringValue(item)
+			if err != nil {
+				return nil, err
+			}
+			raw = append(raw, s)
+		}
+	case []string:
+		raw = v
+	default:
+		return nil, fmt.Errorf("expected a list, got %T", v)
+	}
+
+	var out []string
+	for _, s := range raw {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
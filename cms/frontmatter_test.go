@@ -0,0 +1,123 @@
+package cms
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name              string
+		content           string
+		fence, meta, body string
+		ok                bool
+	}{
+		{"yaml", "---\ntitle: Hi\n---\nBody", "---", "title: Hi", "Body", true},
+		{"toml", "+++\ntitle = 'Hi'\n+++\nBody", "+++", "title = 'Hi'", "Body", true},
+		{"blank lines and BOM first", "\ufeff\n\n---\ntitle: Hi\n---\n", "---", "title: Hi", "", true},
+		{"spaces around fences", "---  \ntitle: Hi\n  ---\nBody", "---", "title: Hi", "Body", true},
+		{"fences must match", "---\ntitle: Hi\n+++\nBody", "", "", "", false},
+		{"never closed", "---\ntitle: Hi\nBody", "", "", "", false},
+		{"no fence", "Title: Hi\n---\nBody", "", "", "", false},
+		{"empty", "", "", "", "", false},
+		{"only blank lines", "\n\n", "", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fence, meta, body, ok := splitFrontMatter(tt.content)
+			if fence != tt.fence || meta != tt.meta || body != tt.body || ok != tt.ok {
+				t.Errorf("splitFrontMatter = %q, %q, %q, %v; want %q, %q, %q, %v",
+					fence, meta, body, ok, tt.fence, tt.meta, tt.body, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseBlogPost(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    BlogPost // HTMLContent is checked with contains
+		wantErr error    // nil, errMissingTitle, or errAny
+	}{
+		{
+			name:    "yaml front matter",
+			content: "---\ntitle: Hello\ndate: 2024-05-01\ntags: [a, b]\nstatus: draft\nmood: happy\n---\n# Heading",
+			want:    BlogPost{Title: "Hello", Date: "2024-05-01", Tags: []string{"a", "b"}, Status: StatusDraft, Extra: map[string]any{"mood": "happy"}, HTMLContent: "<h1"},
+		},
+		{
+			name:    "toml front matter",
+			content: "+++\ntitle = \"Hello\"\npublish_at = 2024-05-01T09:00:00Z\n+++\nBody",
+			want:    BlogPost{Title: "Hello", PublishAt: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC), HTMLContent: "<p>Body</p>"},
+		},
+		{
+			name:    "front matter without a title",
+			content: "---\ndate: 2024-05-01\n---\nBody",
+			wantErr: errMissingTitle,
+		},
+		{
+			name:    "legacy header",
+			content: "Title: Hello\nTags: a, b\nSeries: One\n---\nBody",
+			want:    BlogPost{Title: "Hello", Tags: []string{"a", "b"}, Extra: map[string]any{"Series": "One"}, HTMLContent: "<p>Body</p>"},
+		},
+		{
+			name:    "legacy header without a title",
+			content: "Date: 2024-05-01\n---\nBody",
+			wantErr: errMissingTitle,
+		},
+		{
+			name:    "legacy header with a bad status",
+			content: "Title: Hello\nStatus: drafty\n---\nBody",
+			wantErr: errAny,
+		},
+		{
+			name:    "horizontal rule after prose",
+			content: "Just some thoughts.\n\n---\n\nMore thoughts.",
+			want:    BlogPost{Title: "Untitled", HTMLContent: "<hr"},
+		},
+		{
+			name:    "no separator, metadata-looking first line",
+			content: "Title: Hello\n\nNo header here.",
+			want:    BlogPost{Title: "Hello", HTMLContent: "No header here."},
+		},
+		{
+			name:    "no separator, a sentence that looks like a bad status",
+			content: "Status: feeling great\n\nToday was fun.",
+			want:    BlogPost{Title: "Untitled", HTMLContent: "Today was fun."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBlogPost("file1", tt.content)
+			switch {
+			case tt.wantErr == errAny:
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(got.HTMLContent, tt.want.HTMLContent) {
+				t.Errorf("HTMLContent = %q, want it to contain %q", got.HTMLContent, tt.want.HTMLContent)
+			}
+			got.HTMLContent, tt.want.HTMLContent = "", ""
+			tt.want.ID = "file1"
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBlogPost =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// errAny stands for any error in test tables
+var errAny = errors.New("any error")
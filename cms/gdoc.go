@@ -0,0 +1,346 @@
+package cms
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Google Docs exported as text/html are a single <body> of <p>/<h*>/<ul>
+// elements whose formatting lives in generated classes (.c1{font-weight:700})
+// declared in a <style> block, plus the odd inline style attribute.
+// parseGoogleDoc turns that into plain semantic HTML: formatting classes become
+// <strong>/<em>/<s>/<sup>/<sub>, every class/id/style attribute is dropped,
+// Google's redirect links are unwrapped and images are routed through the
+// worker, see docImageURL.
+
+func isGoogleDoc(mimeType string) bool {
+	return strings.Contains(mimeType, "google-apps.document")
+}
+
+// parseGoogleDoc parses a Google Docs HTML export. Leading paragraphs that
+// look like "Title: ..." header lines are read as metadata, optionally
+// terminated by a "---" paragraph; everything after is the body.
+func parseGoogleDoc(id, content string) (BlogPost, error) {
+	post := BlogPost{ID: id}
+
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return post, fmt.Errorf("parsing google doc html: %w", err)
+	}
+
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		return post, fmt.Errorf("google doc export has no <body>")
+	}
+
+	styles := map[string]string{}
+	if head := findElement(doc, atom.Head); head != nil {
+		for n := head.FirstChild; n != nil; n = n.NextSibling {
+			if n.DataAtom == atom.Style && n.FirstChild != nil {
+				parseDocStyles(n.FirstChild.Data, styles)
+			}
+		}
+	}
+
+	// Read the header block from the top of the document
+	start, err := readDocHeader(body.FirstChild, &post)
+	if err != nil {
+		return post, err
+	}
+
+	w := docWriter{styles: styles}
+	for n := start; n != nil; n = n.NextSibling {
+		w.node(n)
+	}
+	post.HTMLContent = sanitizeHTML(w.b.String())
+	post.docImages = w.images
+
+	return post, nil
+}
+
+// readDocHeader reads the metadata paragraphs at the top of a doc and returns
+// the first body node. Either front matter (a "---" or "+++" paragraph, the
+// YAML/TOML lines, then the same fence again) or legacy "Key: value"
+// paragraphs optionally closed by "---" are accepted.
+func readDocHeader(n *html.Node, post *BlogPost) (*html.Node, error) {
+	var fence string
+	var lines []string
+	header := false
+
+	for ; n != nil; n = n.NextSibling {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		if n.DataAtom != atom.P {
+			break
+		}
+		text := strings.TrimSpace(textContent(n))
+
+		if fence != "" {
+			if text == fence {
+				fields, err := decodeFrontMatter(fence, strings.Join(lines, "\n"))
+				if err != nil {
+					return nil, err
+				}
+				return n.NextSibling, applyFrontMatter(post, fields)
+			}
+			lines = append(lines, textContent(n))
+			continue
+		}
+
+		if text == "" {
+			continue
+		}
+		if !header && (text == yamlFence || text == tomlFence) {
+			fence = text
+			continue
+		}
+		if text == "---" {
+			n = n.NextSibling
+			break
+		}
+		known, err := applyMetadataLine(post, text)
+		if err != nil {
+			return nil, err
+		}
+		if !known {
+			break
+		}
+		header = true
+	}
+
+	if fence != "" {
+		return nil, fmt.Errorf("front matter opened with %q is never closed", fence)
+	}
+	if post.Title == "" {
+		if header {
+			return nil, errMissingTitle
+		}
+		post.Title = "Untitled"
+	}
+	return n, nil
+}
+
+// docBlockTags are kept as-is (minus attributes) when cleaning a doc
+var docBlockTags = map[atom.Atom]bool{
+	atom.P: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Blockquote: true, atom.Pre: true, atom.Code: true,
+	atom.Table: true, atom.Thead: true, atom.Tbody: true, atom.Tr: true, atom.Td: true, atom.Th: true,
+	atom.Sup: true, atom.Sub: true, atom.Strong: true, atom.Em: true, atom.B: true, atom.I: true,
+}
+
+type docWriter struct {
+	b         strings.Builder
+	styles    map[string]string
+	inHeading bool
+	images    []docImage // to download, see docImageURL
+}
+
+func (w *docWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.b.WriteString(html.EscapeString(n.Data))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Style, atom.Script, atom.Head, atom.Meta, atom.Title:
+		return
+	case atom.Br:
+		w.b.WriteString("<br/>")
+		return
+	case atom.Hr:
+		w.b.WriteString("<hr/>")
+		return
+	case atom.Img:
+		w.image(n)
+		return
+	case atom.A:
+		w.link(n)
+		return
+	case atom.Span:
+		w.span(n)
+		return
+	}
+
+	tag := n.Data
+	if n.DataAtom == atom.P && hasClass(n, "title") {
+		// Google's "Title" paragraph style
+		tag = "h1"
+	}
+	if !docBlockTags[n.DataAtom] {
+		// Unknown wrapper (div, font, ...): keep only its contents
+		w.children(n)
+		return
+	}
+
+	heading := strings.HasPrefix(tag, "h") && len(tag) == 2
+	inner := docWriter{styles: w.styles, inHeading: w.inHeading || heading}
+	inner.children(n)
+	content := inner.b.String()
+	w.images = append(w.images, inner.images...)
+
+	// Docs pads the layout with empty paragraphs; drop them
+	if n.DataAtom == atom.P && strings.TrimSpace(content) == "" {
+		return
+	}
+
+	fmt.Fprintf(&w.b, "<%s>%s</%s>", tag, content, tag)
+}
+
+func (w *docWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+}
+
+// span replaces a styled <span> with the matching semantic tags
+func (w *docWriter) span(n *html.Node) {
+	decl := getAttr(n, "style")
+	for _, class := range strings.Fields(getAttr(n, "class")) {
+		decl += ";" + w.styles[class]
+	}
+	decl = strings.ToLower(strings.ReplaceAll(decl, " ", ""))
+
+	var tags []string
+	if !w.inHeading && (strings.Contains(decl, "font-weight:700") || strings.Contains(decl, "font-weight:bold")) {
+		tags = append(tags, "strong")
+	}
+	if strings.Contains(decl, "font-style:italic") {
+		tags = append(tags, "em")
+	}
+	if strings.Contains(decl, "line-through") {
+		tags = append(tags, "s")
+	}
+	if strings.Contains(decl, "vertical-align:super") {
+		tags = append(tags, "sup")
+	} else if strings.Contains(decl, "vertical-align:sub") {
+		tags = append(tags, "sub")
+	}
+
+	for _, t := range tags {
+		w.b.WriteString("<" + t + ">")
+	}
+	w.children(n)
+	for i := len(tags) - 1; i >= 0; i-- {
+		w.b.WriteString("</" + tags[i] + ">")
+	}
+}
+
+func (w *docWriter) link(n *html.Node) {
+	href := unwrapGoogleRedirect(getAttr(n, "href"))
+	if href == "" {
+		// Bookmark anchors (<a id="...">) carry no link
+		w.children(n)
+		return
+	}
+	fmt.Fprintf(&w.b, `<a href="%s">`, html.EscapeString(href))
+	w.children(n)
+	w.b.WriteString("</a>")
+}
+
+func (w *docWriter) image(n *html.Node) {
+	src, img := docImageURL(getAttr(n, "src"))
+	if src == "" {
+		return
+	}
+	if img != nil {
+		w.images = append(w.images, *img)
+	}
+	fmt.Fprintf(&w.b, `<img src="%s" alt="%s"/>`, html.EscapeString(src), html.EscapeString(getAttr(n, "alt")))
+}
+
+// unwrapGoogleRedirect turns https://www.google.com/url?q=<target>&sa=D...
+// back into <target>
+func unwrapGoogleRedirect(href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	if strings.HasSuffix(u.Host, "google.com") && u.Path == "/url" {
+		if q := u.Query().Get("q"); q != "" {
+			return q
+		}
+	}
+	return href
+}
+
+var driveFileIDPattern = regexp.MustCompile(`(?:/file/d/|[?&]id=)([\w-]{10,})`)
+
+// docImageURL rewrites an image embedded in a doc to go through the worker.
+// Drive-hosted files use the /gdrivephoto/<id> proxy. Images Docs hosts
+// itself expire, so they are returned as an image to download during the
+// sync and linked as /gdocimage/<key>, see doc_images.go.
+func docImageURL(src string) (string, *docImage) {
+	if m := driveFileIDPattern.FindStringSubmatch(src); m != nil {
+		return "/gdrivephoto/" + m[1], nil
+	}
+	u, err := url.Parse(src)
+	if err != nil || u.Scheme != "https" {
+		return "", nil
+	}
+	if isDocImageHost(u.Host) {
+		img := &docImage{Key: docImageKey([]byte(src)), Src: src}
+		return docImagePath + img.Key, img
+	}
+	return src, nil
+}
+
+var docStyleRule = regexp.MustCompile(`\.([\w-]+)\{([^}]*)\}`)
+
+// parseDocStyles collects the declarations of the single-class rules
+// (.c1{...}) Docs generates for inline formatting
+func parseDocStyles(css string, styles map[string]string) {
+	for _, m := range docStyleRule.FindAllStringSubmatch(css, -1) {
+		styles[m[1]] += ";" + m[2]
+	}
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(getAttr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package cms
+
+import "fmt"
+
+// DefaultMaxDeletePercent is used when PublishChecks.MaxDeletePercent is 0
+const DefaultMaxDeletePercent = 50
+
+// PublishChecks are the safety checks a sync's output must pass before it
+// goes live. A sync that fails them is saved as a staged snapshot, which
+// can be reviewed with DiffSnapshots and published with RollbackSnapshot.
+type PublishChecks struct {
+	// MaxDeletePercent is the largest share of the live posts, and of the
+	// live albums, one sync may remove. 0 means DefaultMaxDeletePercent and
+	// 100 turns the check off.
+	MaxDeletePercent int
+
+	// MinPosts and MinAlbums are the fewest items the site may be left
+	// with. 0 turns the check off.
+	MinPosts  int
+	MinAlbums int
+}
+
+// CheckResult is the outcome of one publish check
+type CheckResult struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message"`
+}
+
+// runChecks checks next against the live content
+func (c PublishChecks) runChecks(live, next content) []CheckResult {
+	maxDelete := c.MaxDeletePercent
+	if maxDelete <= 0 {
+		maxDelete = DefaultMaxDeletePercent
+	}
+
+	checks := []CheckResult{
+		deleteCheck("posts", postIDs(live.Posts), postIDs(next.Posts), maxDelete),
+		deleteCheck("albums", albumIDs(live.Albums), albumIDs(next.Albums), maxDelete),
+	}
+	if c.MinPosts > 0 {
+		checks = append(checks, minCheck("posts", len(next.Posts), c.MinPosts))
+	}
+	if c.MinAlbums > 0 {
+		checks = append(checks, minCheck("albums", len(next.Albums), c.MinAlbums))
+	}
+	return checks
+}
+
+func postIDs(posts []BlogPost) []string {
+	ids := make([]string, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+func albumIDs(albums []CosplayAlbum) []string {
+	ids := make([]string, len(albums))
+	for i, a := range albums {
+		ids[i] = a.ID
+	}
+	return ids
+}
+
+// deleteCheck fails when more than maxPercent of the live items are gone
+func deleteCheck(kind string, live, next []string, maxPercent int) CheckResult {
+	kept := make(map[string]bool, len(next))
+	for _, id := range next {
+		kept[id] = true
+	}
+	removed := 0
+	for _, id := range live {
+		if !kept[id] {
+			removed++
+		}
+	}
+
+	check := CheckResult{Name: "max_delete_percent_" + kind, Passed: true}
+	if len(live) == 0 {
+		check.Message = fmt.Sprintf("no live %s to remove", kind)
+		return check
+	}
+	percent := removed * 100 / len(live)
+	check.Passed = removed*100 <= maxPercent*len(live)
+	check.Message = fmt.Sprintf("%d of %d %s removed (%d%%, limit %d%%)", removed, len(live), kind, percent, maxPercent)
+	return check
+}
+
+// minCheck fails when fewer than min items would be left
+func minCheck(kind string, count, min int) CheckResult {
+	return CheckResult{
+		Name:    "min_" + kind,
+		Passed:  count >= min,
+		Message: fmt.Sprintf("%d %s, minimum %d", count, kind, min),
+	}
+}
+
+// failedChecks returns the checks that didn't pass
+func failedChecks(checks []CheckResult) []CheckResult {
+	var failed []CheckResult
+	for _, c := range checks {
+		if !c.Passed {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
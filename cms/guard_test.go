@@ -0,0 +1,103 @@
+package cms
+
+import (
+	"cloudflare-worker-boilerplate/store"
+	"reflect"
+	"testing"
+)
+
+func TestDeleteCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		live, next []string
+		maxPercent int
+		wantPassed bool
+		wantMsg    string
+	}{
+		{"nothing live", nil, []string{"a"}, 50, true, "no live posts to remove"},
+		{"nothing removed", []string{"a", "b"}, []string{"b", "a", "c"}, 50, true, "0 of 2 posts removed (0%, limit 50%)"},
+		{"at the limit", []string{"a", "b"}, []string{"a"}, 50, true, "1 of 2 posts removed (50%, limit 50%)"},
+		{"over the limit", []string{"a", "b", "c"}, []string{"a"}, 50, false, "2 of 3 posts removed (66%, limit 50%)"},
+		{"rounding doesn't hide a removal", []string{"a", "b", "c"}, []string{"a", "b"}, 33, false, "1 of 3 posts removed (33%, limit 33%)"},
+		{"everything removed", []string{"a"}, nil, 100, true, "1 of 1 posts removed (100%, limit 100%)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := deleteCheck("posts", tt.live, tt.next, tt.maxPercent)
+			if got.Passed != tt.wantPassed || got.Message != tt.wantMsg {
+				t.Errorf("deleteCheck = %+v, want passed %v, %q", got, tt.wantPassed, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestPublishContentStagesOnce(t *testing.T) {
+	st := store.NewMemory()
+	opts := SyncOptions{SnapshotsKept: 2, Checks: PublishChecks{MinPosts: 2}}
+	posts := func(ids ...string) content {
+		var c content
+		for _, id := range ids {
+			c.Posts = append(c.Posts, BlogPost{ID: id, Title: id})
+		}
+		return c
+	}
+
+	live := posts("a", "b")
+	if report := publishContent(st, 0, content{}, live, opts); report.Snapshot != 1 {
+		t.Fatalf("first publish = %+v", report)
+	}
+
+	// Failing the same check with the same content stages it only once
+	for range 3 {
+		report := publishContent(st, 1, live, posts("a"), opts)
+		if report.Snapshot != 1 || report.Staged != 2 || report.Error == "" {
+			t.Fatalf("failed publish = %+v, want snapshot 2 staged", report)
+		}
+	}
+	report := publishContent(st, 1, live, posts("b"), opts)
+	if report.Staged != 3 || !reflect.DeepEqual(report.Pruned, []int{2}) {
+		t.Errorf("publish of other content = %+v, want 3 staged and 2 pruned", report)
+	}
+
+	// Staged snapshots don't push published ones out
+	for _, next := range []content{posts("a", "b", "c"), posts("a", "b", "d")} {
+		if report := publishContent(st, mustCurrent(t, st), live, next, opts); report.Error != "" {
+			t.Fatalf("publish = %+v", report)
+		}
+	}
+	snapshots, err := ListSnapshots(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, snap := range snapshots {
+		ids = append(ids, snap.ID)
+	}
+	if want := []int{5, 4}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("snapshots after two publishes = %v, want %v", ids, want)
+	}
+
+	// Content staged earlier goes live without a new snapshot once the
+	// checks pass
+	if report := publishContent(st, 5, posts("a", "b", "d"), posts("b"), opts); report.Staged != 6 {
+		t.Fatalf("failed publish = %+v", report)
+	}
+	opts.Checks = PublishChecks{MaxDeletePercent: 100}
+	report = publishContent(st, 5, posts("a", "b", "d"), posts("b"), opts)
+	if report.Snapshot != 6 || report.Staged != 0 {
+		t.Errorf("publish after relaxing checks = %+v, want snapshot 6 live", report)
+	}
+	snapshots, _ = ListSnapshots(st)
+	if snapshots[0].ID != 6 || snapshots[0].Staged {
+		t.Errorf("newest snapshot = %+v, want 6 no longer staged", snapshots[0])
+	}
+}
+
+func mustCurrent(t *testing.T, st store.Store) int {
+	t.Helper()
+	id, err := CurrentSnapshot(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
@@ -0,0 +1,175 @@
+package cms
+
+import "sync"
+
+// BlogManifest records which Drive revision each stored post was built from,
+// keyed by Drive file ID. It is persisted next to blog_data so the next sync
+// can skip files that have not changed.
+type BlogManifest map[string]ManifestEntry
+
+type ManifestEntry struct {
+	Name         string `json:"name"`
+	ModifiedTime string `json:"modified_time"`
+	Md5Checksum  string `json:"md5_checksum,omitempty"`
+	Category     string `json:"category,omitempty"`
+}
+
+func manifestEntryFor(file DriveFile) ManifestEntry {
+	return ManifestEntry{
+		Name:         file.Name,
+		ModifiedTime: file.ModifiedTime,
+		Md5Checksum:  file.Md5Checksum,
+		Category:     file.Category,
+	}
+}
+
+// BlogSync is the outcome of an incremental blog sync
+type BlogSync struct {
+	Posts    []BlogPost
+	Manifest BlogManifest
+
+	Added     int
+	Updated   int
+	Unchanged int
+	Removed   int
+	Failed    int
+
+	// Errors has one entry per failed file, a *ParseError or *FetchError
+	Errors []error
+
+	// reslugged is set when unchanged posts were given new slugs
+	reslugged bool
+}
+
+// Changed reports whether the sync produced anything worth writing back
+func (s BlogSync) Changed() bool {
+	return s.Added+s.Updated+s.Removed > 0 || s.reslugged
+}
+
+// SyncBlogPosts lists the blog folder and only downloads files whose
+// modifiedTime, checksum or category differ from the manifest. Unchanged
+// files reuse the matching post from previous. Files that are no longer in
+// the listing (deleted, trashed or moved elsewhere) are dropped.
+func (c *DriveClient) SyncBlogPosts(folderID string, manifest BlogManifest, previous []BlogPost) (BlogSync, error) {
+	files, err := c.listFolderRecursive(folderID)
+	if err != nil {
+		return BlogSync{}, err
+	}
+
+	previousByID := make(map[string]BlogPost, len(previous))
+	for _, post := range previous {
+		previousByID[post.ID] = post
+	}
+
+	// Work out which files need downloading before fetching any of them
+	seen := make(map[string]bool, len(files))
+	var stale []int
+	for i, file := range files {
+		seen[file.ID] = true
+		oldEntry, known := manifest[file.ID]
+		_, havePost := previousByID[file.ID]
+		if !known || !havePost || oldEntry != manifestEntryFor(file) {
+			stale = append(stale, i)
+		}
+	}
+
+	fetched := c.fetchBlogPosts(files, stale)
+
+	// Assemble in listing order regardless of which download finished first
+	result := BlogSync{Manifest: BlogManifest{}}
+	for i, file := range files {
+		entry := manifestEntryFor(file)
+		oldEntry, known := manifest[file.ID]
+		oldPost, havePost := previousByID[file.ID]
+
+		f, wasFetched := fetched[i]
+		if !wasFetched {
+			result.Posts = append(result.Posts, oldPost)
+			result.Manifest[file.ID] = oldEntry
+			result.Unchanged++
+			continue
+		}
+
+		if f.err != nil {
+			err := f.err
+			if _, ok := err.(*ParseError); !ok {
+				err = &FetchError{FileID: file.ID, FileName: file.Name, Err: err}
+			}
+			result.Errors = append(result.Errors, err)
+			result.Failed++
+			// Keep serving the last good version and retry on the next sync
+			if havePost {
+				result.Posts = append(result.Posts, oldPost)
+				if known {
+					result.Manifest[file.ID] = oldEntry
+				}
+			}
+			continue
+		}
+
+		if havePost {
+			// An edited post keeps its URL unless the doc names a new Slug:
+			if f.post.Slug == "" {
+				f.post.Slug = oldPost.Slug
+			}
+			result.Updated++
+		} else {
+			result.Added++
+		}
+		result.Posts = append(result.Posts, f.post)
+		result.Manifest[file.ID] = entry
+	}
+
+	for id := range previousByID {
+		if !seen[id] {
+			result.Removed++
+		}
+	}
+
+	result.reslugged = assignSlugs(result.Posts)
+
+	return result, nil
+}
+
+type fetchedPost struct {
+	post BlogPost
+	err  error
+}
+
+// fetchBlogPosts downloads files[i] for every i in indexes using a pool of
+// c.Concurrency workers. Results are keyed by index.
+func (c *DriveClient) fetchBlogPosts(files []DriveFile, indexes []int) map[int]fetchedPost {
+	workers := c.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(indexes) {
+		workers = len(indexes)
+	}
+
+	jobs := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[int]fetchedPost, len(indexes))
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				post, err := c.fetchBlogPost(files[i])
+				mu.Lock()
+				results[i] = fetchedPost{post: post, err: err}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, i := range indexes {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,50 @@
+package cms
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// markdown renders CommonMark plus the GitHub extensions we rely on
+// (tables, strikethrough, task lists and bare-URL autolinks).
+// Raw HTML is passed through here on purpose: everything goes through
+// htmlPolicy afterwards, so authors can still use the odd <kbd> or <sup>.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(html.WithUnsafe()),
+)
+
+// htmlPolicy is the allowlist applied to every rendered post body before it
+// is stored in KV.
+var htmlPolicy = newHTMLPolicy()
+
+func newHTMLPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	// Keep the language hint on fenced code blocks for syntax highlighting
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]+$`)).OnElements("code")
+	// GFM task list checkboxes
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	// Links to other sites open in a new tab
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}
+
+// renderMarkdown converts a Markdown document to sanitized HTML
+func renderMarkdown(src string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(src), &buf); err != nil {
+		return "", err
+	}
+	return sanitizeHTML(buf.String()), nil
+}
+
+// sanitizeHTML strips anything not on the htmlPolicy allowlist
+func sanitizeHTML(s string) string {
+	return htmlPolicy.Sanitize(s)
+}
@@ -0,0 +1,54 @@
+package cms
+
+import (
+	"cloudflare-worker-boilerplate/store"
+	"fmt"
+)
+
+// MigrationResult reports what MigrateContent converted
+type MigrationResult struct {
+	// Created is the snapshot made from the unversioned keys, 0 if none
+	Created int `json:"created,omitempty"`
+}
+
+// MigrateContent saves content still in the unversioned keys as the first
+// snapshot, in the layout described in content.go, and makes it live. The
+// unversioned keys are only deleted once the snapshot is live, so readers
+// keep working throughout and an interrupted migration can simply be run
+// again.
+func MigrateContent(st store.Store) (*MigrationResult, error) {
+	result := &MigrationResult{}
+
+	liveID, err := CurrentSnapshot(st)
+	if err != nil || liveID != 0 {
+		return result, err
+	}
+	c, err := loadLegacy(st)
+	if err != nil {
+		return result, err
+	}
+	if len(c.Posts) > 0 || len(c.Albums) > 0 {
+		snap, err := saveSnapshot(st, c, false)
+		if err != nil {
+			return result, err
+		}
+		if err := setCurrentSnapshot(st, snap.ID); err != nil {
+			return result, err
+		}
+		result.Created = snap.ID
+	}
+	for _, key := range legacyKeys {
+		if err := st.Delete(key); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// Text renders the result as plain text for terminals and logs
+func (r *MigrationResult) Text() string {
+	if r.Created == 0 {
+		return "Nothing to migrate\n"
+	}
+	return fmt.Sprintf("Unversioned content saved as snapshot %d\n", r.Created)
+}
@@ -0,0 +1,106 @@
+package cms
+
+import (
+	"cloudflare-worker-boilerplate/store"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Photos baseUrls stop working about an hour after they're issued, so cached
+// ones are dropped a little before that
+const photoURLCacheTTL = 50 * time.Minute
+
+// A media item Photos doesn't know is remembered for a while, so asking for
+// it again doesn't cost another API call
+const (
+	photoNotFoundTTL    = time.Hour
+	photoNotFoundMarker = "-"
+)
+
+const photoURLKeyPrefix = "gphoto_url:"
+
+// ErrPhotoNotFound is returned for a media item that isn't in any live album,
+// or that Photos no longer has
+var ErrPhotoNotFound = errors.New("photo not found")
+
+// ResolvePhotoURL returns a current baseUrl for a media item, using the copy
+// cached in st while it's still fresh. With a nil client only the cache is
+// consulted and "" is returned on a miss, so callers can skip fetching an
+// access token when they don't need one.
+//
+// /gphoto/ is public, so IDs that aren't in the live snapshot are turned
+// away with ErrPhotoNotFound before anything is asked of the Photos API.
+func ResolvePhotoURL(st store.Store, photos *PhotosClient, mediaItemID string) (string, error) {
+	key := photoURLKeyPrefix + mediaItemID
+	if cached, err := st.Get(key); err == nil && cached != "" {
+		if cached == photoNotFoundMarker {
+			return "", ErrPhotoNotFound
+		}
+		return cached, nil
+	}
+
+	synced, err := isSyncedPhoto(st, mediaItemID)
+	if err != nil {
+		return "", err
+	}
+	if !synced {
+		return "", ErrPhotoNotFound
+	}
+	if photos == nil {
+		return "", nil
+	}
+
+	baseURL, err := photos.MediaItemURL(mediaItemID)
+	if errors.Is(err, ErrPhotoNotFound) {
+		if err := st.Put(key, photoNotFoundMarker, store.PutOptions{TTL: photoNotFoundTTL}); err != nil {
+			fmt.Println("Error caching missing photo:", err)
+		}
+		return "", err
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := st.Put(key, baseURL, store.PutOptions{TTL: photoURLCacheTTL}); err != nil {
+		fmt.Println("Error caching photo URL:", err)
+	}
+	return baseURL, nil
+}
+
+// isSyncedPhoto reports whether mediaItemID is served by an album of the
+// live snapshot. Snapshots saved before photo_ids was stored don't list
+// their media items, so every ID passes for them.
+func isSyncedPhoto(st store.Store, mediaItemID string) (bool, error) {
+	id, err := CurrentSnapshot(st)
+	if err != nil {
+		return false, err
+	}
+	ids, found, err := store.GetJSON[[]string](st, photoIDsKey(id))
+	if err != nil {
+		return false, fmt.Errorf("reading photo_ids: %w", err)
+	}
+	if !found {
+		return true, nil
+	}
+	i := sort.SearchStrings(ids, mediaItemID)
+	return i < len(ids) && ids[i] == mediaItemID, nil
+}
+
+// photoIDs lists the Photos media items albums link to through /gphoto/,
+// sorted
+func photoIDs(albums []CosplayAlbum) []string {
+	seen := map[string]bool{}
+	ids := []string{}
+	for _, album := range albums {
+		for _, m := range album.Images {
+			if m.ID != "" && strings.HasPrefix(m.URL, PhotoProxyPath) && !seen[m.ID] {
+				seen[m.ID] = true
+				ids = append(ids, m.ID)
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
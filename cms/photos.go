@@ -3,15 +3,47 @@ package cms
 import (
 	"encoding/json"
 	"fmt"
-	"net/http"
+	"io"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type MediaItem struct {
-	ID          string `json:"id"`
-	BaseUrl     string `json:"baseUrl"`
-	MimeType    string `json:"mimeType"`
-	Description string `json:"description"`
+	ID            string        `json:"id"`
+	BaseUrl       string        `json:"baseUrl"`
+	MimeType      string        `json:"mimeType"`
+	Description   string        `json:"description"`
+	Filename      string        `json:"filename"`
+	MediaMetadata MediaMetadata `json:"mediaMetadata"`
+}
+
+// MediaMetadata is the Photos API's per-item metadata. Dimensions are
+// sent as strings.
+type MediaMetadata struct {
+	CreationTime time.Time `json:"creationTime"`
+	Width        string    `json:"width"`
+	Height       string    `json:"height"`
+}
+
+// media converts the item to the stored album model
+func (item MediaItem) media() CosplayMedia {
+	m := CosplayMedia{
+		ID:       item.ID,
+		URL:      PhotoProxyURL(item.ID),
+		Kind:     MediaPhoto,
+		Caption:  strings.TrimSpace(item.Description),
+		TakenAt:  item.MediaMetadata.CreationTime,
+		Filename: item.Filename,
+	}
+	m.Width, _ = strconv.Atoi(item.MediaMetadata.Width)
+	m.Height, _ = strconv.Atoi(item.MediaMetadata.Height)
+	if strings.HasPrefix(item.MimeType, "video/") {
+		m.Kind = MediaVideo
+		m.URL = VideoProxyURL(item.ID)
+	}
+	return m
 }
 
 type PhotosListResponse struct {
@@ -25,66 +57,160 @@ type Album struct {
 }
 
 type AlbumsListResponse struct {
-	Albums []Album `json:"albums"`
+	Albums        []Album `json:"albums"`
+	NextPageToken string  `json:"nextPageToken"`
+}
+
+// AlbumSync is the outcome of discovering and fetching cosplay albums
+type AlbumSync struct {
+	Albums []CosplayAlbum
+
+	// Errors has one *AlbumError per album that matched but couldn't be read
+	Errors []error
+}
+
+// AlbumError is recorded for an album whose details could not be fetched
+type AlbumError struct {
+	AlbumID string
+	Title   string
+	Err     error
+}
+
+func (e *AlbumError) Error() string {
+	return fmt.Sprintf("%s (%s): %v", e.Title, e.AlbumID, e.Err)
+}
+
+func (e *AlbumError) Unwrap() error {
+	return e.Err
 }
 
 // FetchCosplayAlbums fetches all albums and their contents
 // Note: This requires the Photos Library API enabled.
 // Ideally usage of Google Photos API requires OAuth2 user flow, but for a personal site
 // with a long-lived refresh token or API key (public albums), it can work.
-// For this implementation, we will assume standard API usage. We might need to upgrade to
-// Service Account + Domain Delegation or OAuth Refresh Token flow in `sync.go` later.
-func FetchCosplayAlbums(accessToken string) ([]CosplayAlbum, error) {
+// The worker swaps a refresh token for the access token this client holds.
+//
+// Only albums following the "Title | Series" naming convention are kept, or,
+// when c.AlbumPrefix is set, albums whose title starts with that prefix.
+func (c *PhotosClient) FetchCosplayAlbums() (AlbumSync, error) {
 	// 1. List Albums
 	// CAUTION: 'v1/albums' returns only albums created by the app.
-	// We might need to use a specific album ID or list all.
-	// url := fmt.Sprintf("https://photoslibrary.googleapis.com/v1/albums?key=%s", apiKey)
+	albums, err := c.listAlbums()
+	if err != nil {
+		return AlbumSync{}, err
+	}
+
+	// 2. Fetch the contents of every matching album
+	var result AlbumSync
+	for _, a := range albums {
+		if !c.isCosplayAlbum(a.Title) {
+			continue
+		}
+		album, err := c.FetchCosplayAlbumDetails(a.ID)
+		if err != nil {
+			result.Errors = append(result.Errors, &AlbumError{AlbumID: a.ID, Title: a.Title, Err: err})
+			continue
+		}
+		result.Albums = append(result.Albums, album)
+	}
 
-	// NOTE: Because Google Photos API is strict with Auth, this is a placeholder.
-	return nil, fmt.Errorf("FetchCosplayAlbums requires OAuth Access Token, handled in sync.go")
+	return result, nil
 }
 
-// FetchCosplayAlbumDetails fetches details for a specific album using an Access Token
-func FetchCosplayAlbumDetails(albumID, accessToken string) (CosplayAlbum, error) {
-	// 1. Get Album Metadata
-	// Actual implementation with proper request creating
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://photoslibrary.googleapis.com/v1/albums/%s", albumID), nil)
+// listAlbums pages through GET /v1/albums
+func (c *PhotosClient) listAlbums() ([]Album, error) {
+	var albums []Album
+	pageToken := ""
+
+	for {
+		params := url.Values{}
+		params.Set("pageSize", "50") // API maximum
+		if pageToken != "" {
+			params.Set("pageToken", pageToken)
+		}
+
+		resp, err := c.send("GET", "/v1/albums?"+params.Encode(), "")
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != 200 {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("photos api error listing albums: %d %s", resp.StatusCode, string(body))
+		}
 
-	req.Header.Add("Authorization", "Bearer "+accessToken)
+		var list AlbumsListResponse
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+		albums = append(albums, list.Albums...)
+
+		if list.NextPageToken == "" {
+			return albums, nil
+		}
+		pageToken = list.NextPageToken
+	}
+}
+
+// isCosplayAlbum applies the prefix filter, or the "Title | Series"
+// convention when no prefix is configured
+func (c *PhotosClient) isCosplayAlbum(title string) bool {
+	if c.AlbumPrefix != "" {
+		return strings.HasPrefix(title, c.AlbumPrefix)
+	}
+	title, series, ok := strings.Cut(title, "|")
+	return ok && strings.TrimSpace(title) != "" && strings.TrimSpace(series) != ""
+}
+
+// parseAlbumTitle fills Title and Series after removing the configured prefix
+func (c *PhotosClient) parseAlbumTitle(raw string, album *CosplayAlbum) {
+	if c.AlbumPrefix != "" {
+		raw = strings.TrimPrefix(raw, c.AlbumPrefix)
+	}
+	parseAlbumTitle(raw, album)
+}
+
+// parseAlbumTitle fills Title and Series from "Ahri | League of Legends"
+func parseAlbumTitle(raw string, album *CosplayAlbum) {
+	parts := strings.Split(raw, "|")
+	if len(parts) > 0 {
+		album.Title = strings.TrimSpace(parts[0])
+	}
+	if len(parts) > 1 {
+		album.Series = strings.TrimSpace(parts[1])
+	}
+}
+
+// FetchCosplayAlbumDetails fetches details for a specific album using the client's Access Token
+func (c *PhotosClient) FetchCosplayAlbumDetails(albumID string) (CosplayAlbum, error) {
+	// 1. Get Album Metadata
+	resp, err := c.send("GET", "/v1/albums/"+url.PathEscape(albumID), "")
 	if err != nil {
 		return CosplayAlbum{}, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return CosplayAlbum{}, fmt.Errorf("photos api error: %d", resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		return CosplayAlbum{}, fmt.Errorf("photos api error reading album %s: %d %s", albumID, resp.StatusCode, string(body))
 	}
 
 	var googleAlbum Album
 	if err := json.NewDecoder(resp.Body).Decode(&googleAlbum); err != nil {
-		return CosplayAlbum{}, err
+		return CosplayAlbum{}, fmt.Errorf("decoding album %s: %w", albumID, err)
 	}
 
 	// 2. List Media Items in Album
-	searchUrl := "https://photoslibrary.googleapis.com/v1/mediaItems:search"
-	searchBody := fmt.Sprintf(`{"albumId": "%s", "pageSize": "100"}`, albumID)
-
-	req, _ = http.NewRequest("POST", searchUrl, strings.NewReader(searchBody))
-	req.Header.Add("Authorization", "Bearer "+accessToken)
-	req.Header.Add("Content-Type", "application/json")
-
-	resp, err = client.Do(req)
+	items, err := c.listAlbumMedia(albumID)
 	if err != nil {
 		return CosplayAlbum{}, err
 	}
-	defer resp.Body.Close()
-
-	var list PhotosListResponse
-	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
-		return CosplayAlbum{}, err
+	if len(items) == 0 {
+		return CosplayAlbum{}, fmt.Errorf("album %q has no media items", googleAlbum.Title)
 	}
 
 	// 3. Construct CosplayAlbum
@@ -93,39 +219,132 @@ func FetchCosplayAlbumDetails(albumID, accessToken string) (CosplayAlbum, error)
 	}
 
 	// Parse Title: "Ahri | League of Legends"
-	parts := strings.Split(googleAlbum.Title, "|")
-	if len(parts) > 0 {
-		album.Title = strings.TrimSpace(parts[0])
-	}
-	if len(parts) > 1 {
-		album.Series = strings.TrimSpace(parts[1])
-	}
+	c.parseAlbumTitle(googleAlbum.Title, &album)
 
 	// Parse Images
-	for i, item := range list.MediaItems {
-		// Google Photos Base URLs need parameters to be useful
-		// =w1600-h1600 allows high res
-		finalUrl := item.BaseUrl + "=w1920-h1080"
-		album.Images = append(album.Images, finalUrl)
-
-		// First image is cover
-		if i == 0 {
-			album.CoverImage = finalUrl
-		}
+	// baseUrls expire after about an hour, so store proxy URLs keyed by the
+	// media item ID and let the worker look up a fresh baseUrl
+	for _, item := range items {
+		album.Images = append(album.Images, item.media())
 	}
+	album.CoverImage = coverURL(album.Images)
 
 	// We'll leave metadata parsing logic (Description, Photographer)
 	// typically this comes from the Album "shareInfo" or we look for a specific
 	// "info.txt" or just use the Description of the *First Photo* (Cover)
 	// Let's use the Cover Photo Description for metadata
-	if len(list.MediaItems) > 0 {
-		desc := list.MediaItems[0].Description
-		parseMetadataFromDescription(desc, &album)
+	parseMetadataFromDescription(items[0].Description, &album)
+	if isAlbumMetadata(items[0].Description) {
+		album.Images[0].Caption = ""
+		album.Images[0].AlbumInfo = true
 	}
+	fillAltText(&album)
 
 	return album, nil
 }
 
+// PhotoProxyPath is the worker route serving Photos media items by ID
+const PhotoProxyPath = "/gphoto/"
+
+// PhotoProxyURL returns the stable URL for a media item
+func PhotoProxyURL(mediaItemID string) string {
+	return PhotoProxyPath + url.PathEscape(mediaItemID)
+}
+
+// VideoProxyURL returns the stable URL that plays a video media item
+func VideoProxyURL(mediaItemID string) string {
+	return PhotoProxyURL(mediaItemID) + "?kind=video"
+}
+
+// MediaItemURL looks up the current baseUrl of a media item. The URL is
+// only valid for about an hour; see ResolvePhotoURL for the cached lookup.
+func (c *PhotosClient) MediaItemURL(mediaItemID string) (string, error) {
+	resp, err := c.send("GET", "/v1/mediaItems/"+url.PathEscape(mediaItemID), "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Made-up IDs get 400 INVALID_ARGUMENT rather than 404
+	if resp.StatusCode == 404 || resp.StatusCode == 400 {
+		return "", fmt.Errorf("media item %s: %w", mediaItemID, ErrPhotoNotFound)
+	}
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("photos api error reading media item %s: %d %s", mediaItemID, resp.StatusCode, string(body))
+	}
+
+	var item MediaItem
+	if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+		return "", fmt.Errorf("decoding media item %s: %w", mediaItemID, err)
+	}
+	if item.BaseUrl == "" {
+		return "", fmt.Errorf("media item %s has no baseUrl", mediaItemID)
+	}
+	return item.BaseUrl, nil
+}
+
+// mediaSearchRequest is the body of POST /v1/mediaItems:search
+type mediaSearchRequest struct {
+	AlbumID   string `json:"albumId"`
+	PageSize  int    `json:"pageSize"`
+	PageToken string `json:"pageToken,omitempty"`
+}
+
+// listAlbumMedia pages through every media item in an album
+func (c *PhotosClient) listAlbumMedia(albumID string) ([]MediaItem, error) {
+	var items []MediaItem
+	search := mediaSearchRequest{AlbumID: albumID, PageSize: 100} // API maximum
+
+	for {
+		body, err := json.Marshal(search)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.send("POST", "/v1/mediaItems:search", string(body))
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != 200 {
+			errBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("photos api error listing media in album %s: %d %s", albumID, resp.StatusCode, string(errBody))
+		}
+
+		var list PhotosListResponse
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decoding media items for album %s: %w", albumID, err)
+		}
+
+		items = append(items, list.MediaItems...)
+
+		if list.NextPageToken == "" {
+			return items, nil
+		}
+		search.PageToken = list.NextPageToken
+	}
+}
+
+// albumMetadataKeys are the lines parseMetadataFromDescription understands
+var albumMetadataKeys = []string{"Photographer:", "Assistant:", "Location:", "Description:", "Cover:", "Event:", "Date:"}
+
+// isAlbumMetadata reports whether a description holds album metadata rather
+// than a caption for the photo itself
+func isAlbumMetadata(desc string) bool {
+	for _, line := range strings.Split(desc, "\n") {
+		for _, key := range albumMetadataKeys {
+			if strings.HasPrefix(line, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func parseMetadataFromDescription(desc string, album *CosplayAlbum) {
 	lines := strings.Split(desc, "\n")
 	for _, line := range lines {
@@ -137,6 +356,12 @@ func parseMetadataFromDescription(desc string, album *CosplayAlbum) {
 			album.Location = strings.TrimSpace(strings.TrimPrefix(line, "Location:"))
 		} else if strings.HasPrefix(line, "Description:") {
 			album.Description = strings.TrimSpace(strings.TrimPrefix(line, "Description:"))
+		} else if strings.HasPrefix(line, "Cover:") {
+			album.Cover = strings.TrimSpace(strings.TrimPrefix(line, "Cover:"))
+		} else if strings.HasPrefix(line, "Event:") {
+			album.Event = strings.TrimSpace(strings.TrimPrefix(line, "Event:"))
+		} else if strings.HasPrefix(line, "Date:") {
+			album.Date = normalizeAlbumDate(strings.TrimPrefix(line, "Date:"))
 		}
 	}
 	// Fallback/Cleanup
@@ -0,0 +1,29 @@
+package cms
+
+import "time"
+
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+)
+
+// Published reports whether the post should be visible at now: it is not a
+// draft and its PublishAt time, if any, has passed.
+func (p BlogPost) Published(now time.Time) bool {
+	if p.Status == StatusDraft {
+		return false
+	}
+	return p.PublishAt.IsZero() || !now.Before(p.PublishAt)
+}
+
+// PublishedPosts filters posts down to the ones visible at now, keeping order.
+// Call it with the request time so scheduled posts appear without a new sync.
+func PublishedPosts(posts []BlogPost, now time.Time) []BlogPost {
+	var visible []BlogPost
+	for _, p := range posts {
+		if p.Published(now) {
+			visible = append(visible, p)
+		}
+	}
+	return visible
+}
@@ -0,0 +1,291 @@
+package cms
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Outcome summarises how a sync (or one of its sources) went
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success" // everything synced
+	OutcomePartial Outcome = "partial" // saved, but some items failed
+	OutcomeFailed  Outcome = "failed"  // nothing usable was saved
+	OutcomeSkipped Outcome = "skipped" // source not configured
+)
+
+// SyncResult is the report produced by SyncContent
+type SyncResult struct {
+	Outcome    Outcome         `json:"outcome"`
+	StartedAt  time.Time       `json:"started_at"`
+	DurationMS int64           `json:"duration_ms"`
+	Sources    []*SourceResult `json:"sources"`
+	Publish    *PublishResult  `json:"publish,omitempty"`
+}
+
+// PublishResult reports on saving the synced content as a snapshot
+type PublishResult struct {
+	Snapshot int           `json:"snapshot"`           // live after the sync, 0 if none yet
+	Previous int           `json:"previous,omitempty"` // live before, set when a new snapshot went live
+	Staged   int           `json:"staged,omitempty"`   // saved but held back by a failed check
+	Checks   []CheckResult `json:"checks,omitempty"`
+	Pruned   []int         `json:"pruned,omitempty"` // old snapshots deleted
+	Error    string        `json:"error,omitempty"`  // why the content didn't go live
+	Notes    []string      `json:"notes,omitempty"`
+}
+
+// SourceResult reports on one content source (Drive blog posts, Photos albums)
+type SourceResult struct {
+	Source     string      `json:"source"`
+	Outcome    Outcome     `json:"outcome"`
+	Added      int         `json:"added"`
+	Updated    int         `json:"updated"`
+	Unchanged  int         `json:"unchanged"`
+	Removed    int         `json:"removed"`
+	Failed     int         `json:"failed"`
+	Errors     []ItemError `json:"errors,omitempty"`
+	Warnings   []ItemError `json:"warnings,omitempty"` // synced, but worth fixing at the source
+	Error      string      `json:"error,omitempty"`    // why the whole source failed
+	Notes      []string    `json:"notes,omitempty"`
+	DurationMS int64       `json:"duration_ms"`
+
+	started time.Time
+}
+
+// ItemError records a single post or album that could not be synced, or
+// that synced with a warning
+type ItemError struct {
+	ID      string `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"error"`
+}
+
+// FetchError is recorded for a Drive file that could not be downloaded
+type FetchError struct {
+	FileID   string
+	FileName string
+	Err      error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("%s (%s): %v", e.FileName, e.FileID, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// InputError is returned by admin operations asked to do something that
+// can't be done, such as using an album or snapshot that doesn't exist.
+// Other errors come from reading or writing the store.
+type InputError struct {
+	Message string
+}
+
+func (e *InputError) Error() string {
+	return e.Message
+}
+
+func inputErrorf(format string, args ...any) error {
+	return &InputError{Message: fmt.Sprintf(format, args...)}
+}
+
+func newSyncResult() *SyncResult {
+	return &SyncResult{StartedAt: time.Now()}
+}
+
+// source starts timing a new source section of the report
+func (r *SyncResult) source(name string) *SourceResult {
+	s := &SourceResult{Source: name, started: time.Now()}
+	r.Sources = append(r.Sources, s)
+	return s
+}
+
+// finish stamps durations and works out the outcomes. The sync as a whole
+// failed if any configured source failed outright.
+func (r *SyncResult) finish() {
+	r.Outcome = OutcomeSuccess
+	for _, s := range r.Sources {
+		if s.Outcome == "" {
+			s.Outcome = OutcomeSuccess
+			if s.Failed > 0 {
+				s.Outcome = OutcomePartial
+			}
+		}
+		s.DurationMS = time.Since(s.started).Milliseconds()
+
+		switch {
+		case s.Outcome == OutcomeFailed:
+			r.Outcome = OutcomeFailed
+		case s.Outcome == OutcomePartial && r.Outcome == OutcomeSuccess:
+			r.Outcome = OutcomePartial
+		}
+	}
+	if r.Publish != nil && r.Publish.Error != "" {
+		r.Outcome = OutcomeFailed
+	}
+	r.DurationMS = time.Since(r.StartedAt).Milliseconds()
+}
+
+// Err returns a non-nil error when the sync failed
+func (r *SyncResult) Err() error {
+	if r.Outcome != OutcomeFailed {
+		return nil
+	}
+	var msgs []string
+	for _, s := range r.Sources {
+		if s.Outcome == OutcomeFailed {
+			msgs = append(msgs, s.Source+": "+s.Error)
+		}
+	}
+	if r.Publish != nil && r.Publish.Error != "" {
+		msgs = append(msgs, "publish: "+r.Publish.Error)
+	}
+	return errors.New("sync failed: " + strings.Join(msgs, "; "))
+}
+
+func (s *SourceResult) fail(err error) {
+	s.Outcome = OutcomeFailed
+	s.Error = err.Error()
+}
+
+func (s *SourceResult) skip(reason string) {
+	s.Outcome = OutcomeSkipped
+	s.Notes = append(s.Notes, reason)
+}
+
+func (s *SourceResult) note(format string, args ...any) {
+	s.Notes = append(s.Notes, fmt.Sprintf(format, args...))
+}
+
+// itemError flattens the per-file errors returned by the fetchers
+func itemError(err error) ItemError {
+	var pe *ParseError
+	if errors.As(err, &pe) {
+		return ItemError{ID: pe.FileID, Name: pe.FileName, Message: pe.Err.Error()}
+	}
+	var fe *FetchError
+	if errors.As(err, &fe) {
+		return ItemError{ID: fe.FileID, Name: fe.FileName, Message: fe.Err.Error()}
+	}
+	var ae *AlbumError
+	if errors.As(err, &ae) {
+		return ItemError{ID: ae.AlbumID, Name: ae.Title, Message: ae.Err.Error()}
+	}
+	return ItemError{Message: err.Error()}
+}
+
+// Text renders the report as plain text for terminals and logs
+func (r *SyncResult) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Sync %s in %dms\n", r.Outcome, r.DurationMS)
+	for _, s := range r.Sources {
+		fmt.Fprintf(&b, "\n[%s] %s (%dms)\n", s.Source, s.Outcome, s.DurationMS)
+		if s.Error != "" {
+			fmt.Fprintf(&b, "  Error: %s\n", s.Error)
+		}
+		if s.Outcome != OutcomeSkipped && s.Error == "" {
+			fmt.Fprintf(&b, "  %d added, %d updated, %d unchanged, %d removed, %d failed\n",
+				s.Added, s.Updated, s.Unchanged, s.Removed, s.Failed)
+		}
+		for _, e := range s.Errors {
+			if e.Name != "" {
+				fmt.Fprintf(&b, "  Failed: %s (%s): %s\n", e.Name, e.ID, e.Message)
+			} else {
+				fmt.Fprintf(&b, "  Failed: %s\n", e.Message)
+			}
+		}
+		for _, w := range s.Warnings {
+			fmt.Fprintf(&b, "  Warning: %s (%s): %s\n", w.Name, w.ID, w.Message)
+		}
+		for _, n := range s.Notes {
+			fmt.Fprintf(&b, "  %s\n", n)
+		}
+	}
+	if p := r.Publish; p != nil {
+		b.WriteString("\n[publish]\n")
+		switch {
+		case p.Staged != 0:
+			fmt.Fprintf(&b, "  Error: %s\n", p.Error)
+			fmt.Fprintf(&b, "  Snapshot %d is staged, %d stays live\n", p.Staged, p.Snapshot)
+		case p.Error != "":
+			fmt.Fprintf(&b, "  Error: %s\n", p.Error)
+		case p.Previous != 0:
+			fmt.Fprintf(&b, "  Snapshot %d is live (was %d)\n", p.Snapshot, p.Previous)
+		case p.Snapshot != 0:
+			fmt.Fprintf(&b, "  Snapshot %d is live\n", p.Snapshot)
+		}
+		for _, c := range p.Checks {
+			status := "ok"
+			if !c.Passed {
+				status = "FAILED"
+			}
+			fmt.Fprintf(&b, "  Check %s %s: %s\n", c.Name, status, c.Message)
+		}
+		if len(p.Pruned) > 0 {
+			fmt.Fprintf(&b, "  Pruned snapshots %v\n", p.Pruned)
+		}
+		for _, n := range p.Notes {
+			fmt.Fprintf(&b, "  %s\n", n)
+		}
+	}
+	return b.String()
+}
+
+// countAlbumChanges fills in the added/updated/unchanged/removed counts by
+// comparing the live albums with the freshly fetched ones
+func countAlbumChanges(s *SourceResult, previous, current []CosplayAlbum) {
+	prevByID := make(map[string]CosplayAlbum, len(previous))
+	for _, a := range previous {
+		prevByID[a.ID] = a
+	}
+	seen := make(map[string]bool, len(current))
+	for _, a := range current {
+		seen[a.ID] = true
+		old, ok := prevByID[a.ID]
+		switch {
+		case !ok:
+			s.Added++
+		case reflect.DeepEqual(old, a):
+			s.Unchanged++
+		default:
+			s.Updated++
+		}
+	}
+	for id := range prevByID {
+		if !seen[id] {
+			s.Removed++
+		}
+	}
+}
+
+// warnMissingCaptions flags albums with photos that have no description, as
+// those fall back to generated alt text. A photo whose description was used
+// for the album's details isn't expected to have one.
+func warnMissingCaptions(s *SourceResult, albums []CosplayAlbum) {
+	for _, album := range albums {
+		var missing []string
+		for i, m := range album.Images {
+			if m.Caption != "" || m.AlbumInfo {
+				continue
+			}
+			name := m.Filename
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			missing = append(missing, name)
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		s.Warnings = append(s.Warnings, ItemError{
+			ID:      album.ID,
+			Name:    album.Title,
+			Message: fmt.Sprintf("%d of %d photos have no description: %s", len(missing), len(album.Images), strings.Join(missing, ", ")),
+		})
+	}
+}
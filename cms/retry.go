@@ -0,0 +1,105 @@
+package cms
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how requests that hit a rate limit or a server error
+// are retried. Delays grow exponentially from BaseDelay with random jitter,
+// and a Retry-After header from the server is honoured as a minimum.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 4,
+	BaseDelay:  500 * time.Millisecond,
+	MaxDelay:   30 * time.Second,
+}
+
+// do sends the request built by newReq, retrying 429s, 5xx responses and
+// Drive's 403 rate limit errors. newReq is called once per attempt so
+// request bodies can be recreated. The last response is returned as-is once
+// retries run out.
+func (p RetryPolicy) do(client *http.Client, newReq func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if attempt >= p.MaxRetries || !retryable(resp) {
+			return resp, nil
+		}
+
+		delay := p.backoff(attempt)
+		if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			if after > p.MaxDelay {
+				// The server wants us gone for longer than we're willing to wait
+				return resp, nil
+			}
+			if after > delay {
+				delay = after
+			}
+		}
+
+		resp.Body.Close()
+		time.Sleep(delay)
+	}
+}
+
+// backoff returns the delay before retry number attempt+1: half of the
+// exponential step plus a random share of the other half
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << attempt
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func retryable(resp *http.Response) bool {
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true
+	case resp.StatusCode == http.StatusForbidden:
+		// Drive reports quota errors as 403 rateLimitExceeded /
+		// userRateLimitExceeded. Peek at the body and put it back.
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return strings.Contains(string(body), "RateLimitExceeded") || strings.Contains(string(body), "rateLimitExceeded")
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header given either in seconds or as an
+// HTTP date
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,132 @@
+package cms
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{1, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond, 800 * time.Millisecond},
+		{4, 500 * time.Millisecond, time.Second},  // capped
+		{70, 500 * time.Millisecond, time.Second}, // shift overflow
+	}
+	for _, tt := range tests {
+		for range 20 {
+			if d := p.backoff(tt.attempt); d < tt.min || d > tt.max {
+				t.Errorf("backoff(%d) = %v, want within [%v, %v]", tt.attempt, d, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   bool
+	}{
+		{200, "", false},
+		{404, "", false},
+		{429, "", true},
+		{500, "", true},
+		{503, "", true},
+		{403, `{"error":{"errors":[{"reason":"userRateLimitExceeded"}]}}`, true},
+		{403, `{"error":{"errors":[{"reason":"rateLimitExceeded"}]}}`, true},
+		{403, `{"error":{"errors":[{"reason":"insufficientPermissions"}]}}`, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Body: io.NopCloser(strings.NewReader(tt.body))}
+		if got := retryable(resp); got != tt.want {
+			t.Errorf("retryable(%d %s) = %v, want %v", tt.status, tt.body, got, tt.want)
+		}
+		// The body is still there for the caller
+		if body, _ := io.ReadAll(resp.Body); string(body) != tt.body {
+			t.Errorf("body after retryable(%d) = %q", tt.status, body)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"120", 2 * time.Minute, true},
+		{" 5 ", 5 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0, true}, // in the past
+	}
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.header)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got, ok := retryAfter(future); !ok || got < 59*time.Minute || got > time.Hour {
+		t.Errorf("retryAfter(an hour from now) = %v, %v", got, ok)
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+	tests := []struct {
+		name       string
+		responses  []int
+		retryAfter string
+		wantStatus int
+		wantCalls  int
+	}{
+		{"success", []int{200}, "", 200, 1},
+		{"not retryable", []int{404}, "", 404, 1},
+		{"recovers", []int{503, 429, 200}, "", 200, 3},
+		{"gives up", []int{503, 503, 503, 200}, "", 503, 3},
+		{"short Retry-After is waited out", []int{429, 200}, "0", 200, 2},
+		{"long Retry-After gives up", []int{429, 200}, "3600", 429, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// The body is sent again on every attempt
+				if body, _ := io.ReadAll(r.Body); string(body) != "payload" {
+					t.Errorf("attempt %d body = %q", calls+1, body)
+				}
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.responses[calls])
+				calls++
+			}))
+			defer server.Close()
+
+			resp, err := policy.do(server.Client(), func() (*http.Request, error) {
+				return http.NewRequest("POST", server.URL, strings.NewReader("payload"))
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus || calls != tt.wantCalls {
+				t.Errorf("got %d after %d calls, want %d after %d", resp.StatusCode, calls, tt.wantStatus, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package cms
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Slugify lowercases s and reduces it to ASCII letters, digits and dashes,
+// e.g. "Ahri's Tails: Part 2!" -> "ahris-tails-part-2"
+func Slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range norm.NFKD.String(s) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(unicode.ToLower(r))
+			dash = false
+		case unicode.Is(unicode.Mn, r), r == '\'', r == '’':
+			// Drop accents and apostrophes without leaving a gap
+		default:
+			if b.Len() > 0 && !dash {
+				b.WriteByte('-')
+				dash = true
+			}
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// assignSlugs gives every post a unique slug. Posts that already carry one
+// (from a Slug: field or a previous sync, which SyncBlogPosts carries over to
+// edited posts) claim theirs first so existing URLs don't move when a title
+// changes or a new post with a similar title shows up; the rest are
+// generated from the title, falling back to the Drive file ID.
+// It reports whether any slug changed.
+func assignSlugs(posts []BlogPost) bool {
+	changed := false
+	taken := make(map[string]bool, len(posts))
+
+	claim := func(base string) string {
+		slug := base
+		for n := 2; taken[slug]; n++ {
+			slug = fmt.Sprintf("%s-%d", base, n)
+		}
+		taken[slug] = true
+		return slug
+	}
+
+	set := func(p *BlogPost, slug string) {
+		if p.Slug != slug {
+			p.Slug = slug
+			changed = true
+		}
+	}
+
+	for i := range posts {
+		if base := Slugify(posts[i].Slug); base != "" {
+			set(&posts[i], claim(base))
+		}
+	}
+	for i := range posts {
+		if posts[i].Slug != "" {
+			continue
+		}
+		base := Slugify(posts[i].Title)
+		if base == "" || posts[i].Title == "Untitled" {
+			base = strings.ToLower(posts[i].ID)
+		}
+		set(&posts[i], claim(base))
+	}
+	return changed
+}
+
+// Path is the URL of the post's detail page
+func (p BlogPost) Path() string {
+	key := p.Slug
+	if key == "" {
+		// Posts synced before slugs existed
+		key = p.ID
+	}
+	return "/blog/" + url.PathEscape(key)
+}
+
+// FindPost returns the post whose slug (or, for older data, ID) is key
+func FindPost(posts []BlogPost, key string) (BlogPost, bool) {
+	for _, p := range posts {
+		if p.Slug == key || (p.Slug == "" && p.ID == key) {
+			return p, true
+		}
+	}
+	return BlogPost{}, false
+}
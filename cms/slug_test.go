@@ -0,0 +1,94 @@
+package cms
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Ahri's Tails: Part 2!", "ahris-tails-part-2"},
+		{"Hello World", "hello-world"},
+		{"  Leading and trailing  ", "leading-and-trailing"},
+		{"Crème Brûlée", "creme-brulee"},
+		{"Ｆｕｌｌ　Ｗｉｄｔｈ", "full-width"},
+		{"It’s fine", "its-fine"},
+		{"a -- b", "a-b"},
+		{"東京", ""},
+		{"!!!", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Slugify(tt.in); got != tt.want {
+			t.Errorf("Slugify(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAssignSlugs(t *testing.T) {
+	tests := []struct {
+		name    string
+		posts   []BlogPost
+		want    []string
+		changed bool
+	}{
+		{
+			name:    "from titles",
+			posts:   []BlogPost{{ID: "1", Title: "Hello"}, {ID: "2", Title: "World"}},
+			want:    []string{"hello", "world"},
+			changed: true,
+		},
+		{
+			name:    "duplicate titles are numbered",
+			posts:   []BlogPost{{ID: "1", Title: "Hello"}, {ID: "2", Title: "Hello!"}, {ID: "3", Title: "hello"}},
+			want:    []string{"hello", "hello-2", "hello-3"},
+			changed: true,
+		},
+		{
+			name:    "existing slugs keep their URL",
+			posts:   []BlogPost{{ID: "1", Title: "Hello"}, {ID: "2", Title: "Hello", Slug: "hello"}},
+			want:    []string{"hello-2", "hello"},
+			changed: true,
+		},
+		{
+			name:    "set slugs are normalised",
+			posts:   []BlogPost{{ID: "1", Title: "Hello", Slug: "My Custom Slug"}},
+			want:    []string{"my-custom-slug"},
+			changed: true,
+		},
+		{
+			name:    "untitled and unsluggable fall back to the ID",
+			posts:   []BlogPost{{ID: "AbC1", Title: "Untitled"}, {ID: "XyZ2", Title: "東京"}},
+			want:    []string{"abc1", "xyz2"},
+			changed: true,
+		},
+		{
+			name:    "unchanged",
+			posts:   []BlogPost{{ID: "1", Title: "Hello", Slug: "hello"}, {ID: "2", Title: "Hello", Slug: "hello-2"}},
+			want:    []string{"hello", "hello-2"},
+			changed: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := assignSlugs(tt.posts)
+			var got []string
+			for _, p := range tt.posts {
+				got = append(got, p.Slug)
+			}
+			if !reflect.DeepEqual(got, tt.want) || changed != tt.changed {
+				t.Errorf("assignSlugs = %v, changed %v; want %v, changed %v", got, changed, tt.want, tt.changed)
+			}
+		})
+	}
+}
+
+func TestFindPost(t *testing.T) {
+	posts := []BlogPost{{ID: "1", Slug: "hello"}, {ID: "legacy"}}
+	for key, wantID := range map[string]string{"hello": "1", "legacy": "legacy", "1": "", "missing": ""} {
+		p, ok := FindPost(posts, key)
+		if ok != (wantID != "") || p.ID != wantID {
+			t.Errorf("FindPost(%q) = %q, %v; want %q", key, p.ID, ok, wantID)
+		}
+	}
+}
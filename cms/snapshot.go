@@ -0,0 +1,468 @@
+package cms
+
+import (
+	"cloudflare-worker-boilerplate/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every sync that changes anything saves its output as a new numbered
+// snapshot and points snapshot:current at it, so a bad sync can be rolled
+// back. A snapshot is an info key plus its content, laid out as described
+// in content.go:
+//
+//	snapshot:current   "12"
+//	snapshot:last      "13", the last ID handed out
+//	snapshot:00000012  Snapshot JSON, also stored as its metadata
+//	content:00000012:  the indexes of its posts and albums
+//	item:              posts and albums, shared between snapshots
+//
+// Before the first snapshot exists content is read from the unversioned
+// blog_data, blog_manifest and cosplay_data keys written by older syncs.
+const (
+	snapshotPrefix     = "snapshot:"
+	currentSnapshotKey = "snapshot:current"
+	lastSnapshotKey    = "snapshot:last"
+
+	// DefaultSnapshotsKept is how many snapshots are kept when
+	// SyncOptions.SnapshotsKept isn't set
+	DefaultSnapshotsKept = 10
+)
+
+// Snapshot describes one saved version of the site's content
+type Snapshot struct {
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Posts     int       `json:"posts"`
+	Albums    int       `json:"albums"`
+
+	// Staged is set while a snapshot that failed the publish checks has
+	// never been live. Staged snapshots don't count toward SnapshotsKept.
+	Staged bool `json:"staged,omitempty"`
+
+	// Hash identifies the content, so a sync can tell it would only stage
+	// the same content again
+	Hash string `json:"hash,omitempty"`
+}
+
+func snapshotKey(id int) string {
+	return fmt.Sprintf("%s%08d", snapshotPrefix, id)
+}
+
+// parseSnapshotKey returns the ID of a snapshot info key, and false for the
+// current pointer and content keys
+func parseSnapshotKey(name string) (int, bool) {
+	digits, ok := strings.CutPrefix(name, snapshotPrefix)
+	if !ok || strings.Contains(digits, ":") {
+		return 0, false
+	}
+	id, err := strconv.Atoi(digits)
+	return id, err == nil && id > 0
+}
+
+// CurrentSnapshot returns the ID of the live snapshot, 0 when there is none
+func CurrentSnapshot(st store.Store) (int, error) {
+	return readSnapshotID(st, currentSnapshotKey)
+}
+
+// ListSnapshots returns the saved snapshots, newest first
+func ListSnapshots(st store.Store) ([]Snapshot, error) {
+	keys, err := store.ListAll(st, snapshotPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, k := range keys {
+		id, ok := parseSnapshotKey(k.Name)
+		if !ok {
+			continue
+		}
+		// The info is kept as metadata so listing needs no extra reads
+		snap := Snapshot{ID: id}
+		if raw, err := json.Marshal(k.Metadata); err == nil {
+			json.Unmarshal(raw, &snap)
+		}
+		snapshots = append(snapshots, snap)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ID > snapshots[j].ID })
+	return snapshots, nil
+}
+
+// loadSnapshotIndexes is loadIndexes for an existing snapshot
+func loadSnapshotIndexes(st store.Store, id int) ([]postEntry, []albumEntry, error) {
+	if _, err := st.Get(snapshotKey(id)); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil, inputErrorf("snapshot %d not found", id)
+		}
+		return nil, nil, err
+	}
+	posts, albums, _, err := loadIndexes(st, id)
+	return posts, albums, err
+}
+
+// saveSnapshot stores c as a new snapshot numbered after every existing
+// one. It doesn't go live until the current pointer is moved to it.
+func saveSnapshot(st store.Store, c content, staged bool) (Snapshot, error) {
+	id, err := nextSnapshotID(st)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snap := Snapshot{
+		ID:        id,
+		CreatedAt: time.Now().UTC(),
+		Posts:     len(c.Posts),
+		Albums:    len(c.Albums),
+		Staged:    staged,
+		Hash:      contentHash(c),
+	}
+
+	stored := c.stored
+	if stored == nil {
+		stored = map[string]bool{}
+	}
+	if err := writeContent(st, snap.ID, c, stored); err != nil {
+		return Snapshot{}, err
+	}
+
+	// The info key goes last so a half-written snapshot is never listed
+	if err := writeSnapshotInfo(st, snap); err != nil {
+		return Snapshot{}, err
+	}
+	return snap, nil
+}
+
+func writeSnapshotInfo(st store.Store, snap Snapshot) error {
+	var metadata map[string]any
+	raw, _ := json.Marshal(snap)
+	json.Unmarshal(raw, &metadata)
+	return st.Put(snapshotKey(snap.ID), string(raw), store.PutOptions{Metadata: metadata})
+}
+
+// contentHash identifies c as it would be stored
+func contentHash(c content) string {
+	raw, _ := json.Marshal(c)
+	return hashJSON(raw)
+}
+
+// latestStaged returns the newest staged snapshot saved after the live one
+func latestStaged(snapshots []Snapshot, current int) (Snapshot, bool) {
+	for _, snap := range snapshots {
+		if snap.ID <= current {
+			break
+		}
+		if snap.Staged {
+			return snap, true
+		}
+	}
+	return Snapshot{}, false
+}
+
+// nextSnapshotID hands out the ID for a new snapshot. Workers KV listings
+// can lag a recent write by a minute or so, so the listing alone could give
+// out an ID twice; snapshot:last and snapshot:current are read directly and
+// cover what it misses. The ID is used up even if the snapshot is never
+// finished, so its content prefix is never written twice.
+func nextSnapshotID(st store.Store) (int, error) {
+	last, err := readSnapshotID(st, lastSnapshotKey)
+	if err != nil {
+		return 0, err
+	}
+	current, err := CurrentSnapshot(st)
+	if err != nil {
+		return 0, err
+	}
+	existing, err := ListSnapshots(st)
+	if err != nil {
+		return 0, err
+	}
+	id := max(last, current)
+	if len(existing) > 0 {
+		id = max(id, existing[0].ID)
+	}
+	id++
+
+	if _, err := st.Get(snapshotKey(id)); err == nil {
+		return 0, fmt.Errorf("snapshot %d already exists", id)
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return 0, err
+	}
+	if err := st.Put(lastSnapshotKey, strconv.Itoa(id), store.PutOptions{}); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// readSnapshotID reads a key holding a snapshot ID, 0 when it isn't set
+func readSnapshotID(st store.Store, key string) (int, error) {
+	raw, err := st.Get(key)
+	if errors.Is(err, store.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(raw)
+}
+
+func setCurrentSnapshot(st store.Store, id int) error {
+	return st.Put(currentSnapshotKey, strconv.Itoa(id), store.PutOptions{})
+}
+
+// publishSnapshot makes snapshot id live, and no longer staged
+func publishSnapshot(st store.Store, id int) error {
+	raw, err := st.Get(snapshotKey(id))
+	if errors.Is(err, store.ErrNotFound) {
+		return inputErrorf("snapshot %d not found", id)
+	}
+	if err != nil {
+		return err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal([]byte(raw), &snap); err != nil {
+		return fmt.Errorf("reading snapshot %d: %w", id, err)
+	}
+	if snap.Staged {
+		snap.Staged = false
+		if err := writeSnapshotInfo(st, snap); err != nil {
+			return err
+		}
+	}
+	return setCurrentSnapshot(st, id)
+}
+
+// pruneSnapshots deletes all but the newest kept published snapshots, never
+// removing the live one or saved, the snapshot the caller just wrote. Of the
+// staged snapshots only the newest is kept, and only while it is newer than
+// the live one: every sync starts from the live content, so it supersedes the
+// others. Items and Docs images no remaining snapshot points to are deleted
+// with them. It returns the IDs it deleted.
+//
+// The live and saved snapshots may be missing from a lagging listing (see
+// nextSnapshotID), so their items are protected whether listed or not.
+func pruneSnapshots(st store.Store, kept, saved int) ([]int, error) {
+	if kept < 1 {
+		kept = DefaultSnapshotsKept
+	}
+	current, err := CurrentSnapshot(st)
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := ListSnapshots(st)
+	if err != nil {
+		return nil, err
+	}
+
+	protected := map[int]bool{current: true, saved: true}
+	var pruned []int
+	unused := map[string]bool{}
+	published, staged := 0, 0
+	for _, snap := range snapshots {
+		keep := protected[snap.ID]
+		if snap.Staged {
+			staged++
+			keep = keep || (staged == 1 && snap.ID > current)
+		} else {
+			published++
+			keep = keep || published <= kept
+		}
+		if keep {
+			protected[snap.ID] = true
+			continue
+		}
+
+		items, err := itemKeys(st, snap.ID)
+		if err != nil {
+			return pruned, fmt.Errorf("snapshot %d: %w", snap.ID, err)
+		}
+		for key := range items {
+			unused[key] = true
+		}
+		if err := st.Delete(snapshotKey(snap.ID)); err != nil {
+			return pruned, err
+		}
+		if err := deleteContent(st, snap.ID); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, snap.ID)
+	}
+	if len(unused) > 0 {
+		if err := deleteUnusedItems(st, unused, protected); err != nil {
+			return pruned, err
+		}
+	}
+	return pruned, nil
+}
+
+// RollbackSnapshot makes snapshot id live again. Later snapshots are kept, so
+// rolling forward is another rollback.
+func RollbackSnapshot(st store.Store, id int) error {
+	if _, _, err := loadSnapshotIndexes(st, id); err != nil {
+		return err
+	}
+	return publishSnapshot(st, id)
+}
+
+// SnapshotDiff lists what changed between two snapshots
+type SnapshotDiff struct {
+	From   int      `json:"from"`
+	To     int      `json:"to"`
+	Posts  ItemDiff `json:"posts"`
+	Albums ItemDiff `json:"albums"`
+}
+
+// ItemDiff lists the posts or albums added, removed and changed
+type ItemDiff struct {
+	Added   []DiffItem `json:"added,omitempty"`
+	Removed []DiffItem `json:"removed,omitempty"`
+	Changed []DiffItem `json:"changed,omitempty"`
+}
+
+// DiffItem names one post or album in a diff
+type DiffItem struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// DiffSnapshots compares snapshot from with snapshot to. A to of 0 means the
+// live snapshot and a from of 0 the snapshot before to.
+func DiffSnapshots(st store.Store, from, to int) (*SnapshotDiff, error) {
+	if to == 0 {
+		current, err := CurrentSnapshot(st)
+		if err != nil {
+			return nil, err
+		}
+		if current == 0 {
+			return nil, inputErrorf("no snapshots yet")
+		}
+		to = current
+	}
+	if from == 0 {
+		snapshots, err := ListSnapshots(st)
+		if err != nil {
+			return nil, err
+		}
+		for _, snap := range snapshots {
+			if snap.ID < to {
+				from = snap.ID
+				break
+			}
+		}
+		if from == 0 {
+			return nil, inputErrorf("no snapshot before %d", to)
+		}
+	}
+
+	// The indexes carry each item's hash, so no items need reading
+	postsA, albumsA, err := loadSnapshotIndexes(st, from)
+	if err != nil {
+		return nil, err
+	}
+	postsB, albumsB, err := loadSnapshotIndexes(st, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &SnapshotDiff{From: from, To: to}
+	diff.Posts = diffItems(postItems(postsA), postItems(postsB))
+	diff.Albums = diffItems(albumItems(albumsA), albumItems(albumsB))
+	return diff, nil
+}
+
+// diffEntry is one post or album reduced to what diffItems compares
+type diffEntry struct {
+	DiffItem
+	hash string
+}
+
+func postItems(posts []postEntry) []diffEntry {
+	entries := make([]diffEntry, len(posts))
+	for i, p := range posts {
+		entries[i] = diffEntry{DiffItem{ID: p.ID, Name: p.Title}, p.Item}
+	}
+	return entries
+}
+
+func albumItems(albums []albumEntry) []diffEntry {
+	entries := make([]diffEntry, len(albums))
+	for i, a := range albums {
+		entries[i] = diffEntry{DiffItem{ID: a.ID, Name: a.Title}, a.Item}
+	}
+	return entries
+}
+
+// diffItems matches entries by ID, in the order of b then of a
+func diffItems(a, b []diffEntry) ItemDiff {
+	before := make(map[string]diffEntry, len(a))
+	for _, e := range a {
+		before[e.ID] = e
+	}
+	after := make(map[string]bool, len(b))
+
+	var d ItemDiff
+	for _, e := range b {
+		after[e.ID] = true
+		old, ok := before[e.ID]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, e.DiffItem)
+		case old.hash != e.hash:
+			d.Changed = append(d.Changed, e.DiffItem)
+		}
+	}
+	for _, e := range a {
+		if !after[e.ID] {
+			d.Removed = append(d.Removed, e.DiffItem)
+		}
+	}
+	return d
+}
+
+// Text renders the diff as plain text for terminals and logs
+func (d *SnapshotDiff) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Snapshot %d -> %d\n", d.From, d.To)
+	for _, section := range []struct {
+		name string
+		diff ItemDiff
+	}{{"Posts", d.Posts}, {"Albums", d.Albums}} {
+		fmt.Fprintf(&b, "\n%s: %d added, %d removed, %d changed\n",
+			section.name, len(section.diff.Added), len(section.diff.Removed), len(section.diff.Changed))
+		for _, item := range section.diff.Added {
+			fmt.Fprintf(&b, "  + %s (%s)\n", item.Name, item.ID)
+		}
+		for _, item := range section.diff.Removed {
+			fmt.Fprintf(&b, "  - %s (%s)\n", item.Name, item.ID)
+		}
+		for _, item := range section.diff.Changed {
+			fmt.Fprintf(&b, "  ~ %s (%s)\n", item.Name, item.ID)
+		}
+	}
+	return b.String()
+}
+
+// SnapshotsText renders a snapshot list as plain text, marking the live one
+func SnapshotsText(snapshots []Snapshot, current int) string {
+	if len(snapshots) == 0 {
+		return "No snapshots yet\n"
+	}
+	var b strings.Builder
+	for _, snap := range snapshots {
+		marker := " "
+		if snap.ID == current {
+			marker = "*"
+		}
+		staged := ""
+		if snap.Staged {
+			staged = "  (staged)"
+		}
+		fmt.Fprintf(&b, "%s %d  %s  %d posts, %d albums%s\n",
+			marker, snap.ID, snap.CreatedAt.Format("2006-01-02 15:04 MST"), snap.Posts, snap.Albums, staged)
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package cms
+
+import (
+	"cloudflare-worker-boilerplate/store"
+	"reflect"
+	"testing"
+)
+
+// staleList is a store whose listings don't show anything yet, like a
+// Workers KV listing that hasn't caught up with recent writes
+type staleList struct {
+	store.Store
+}
+
+func (staleList) List(opts store.ListOptions) (store.ListResult, error) {
+	return store.ListResult{Complete: true}, nil
+}
+
+func TestSaveSnapshotWithStaleListing(t *testing.T) {
+	st := staleList{store.NewMemory()}
+
+	var ids []int
+	for range 3 {
+		snap, err := saveSnapshot(st, content{}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, snap.ID)
+	}
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("snapshot IDs = %v, want %v", ids, want)
+	}
+
+	// The live pointer counts even without the counter, e.g. after a
+	// rollback on a store written before it existed
+	if err := st.Delete(lastSnapshotKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := setCurrentSnapshot(st, 3); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := saveSnapshot(st, content{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.ID != 4 {
+		t.Errorf("snapshot ID after current 3 = %d, want 4", snap.ID)
+	}
+}
+
+func TestSaveSnapshotRefusesExistingID(t *testing.T) {
+	st := staleList{store.NewMemory()}
+	if err := st.Put(snapshotKey(1), "{}", store.PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := saveSnapshot(st, content{}, false); err == nil {
+		t.Error("saveSnapshot wrote into snapshot 1, which already exists")
+	}
+	if _, found, _ := store.GetJSON[[]BlogPost](st, blogIndexKey(1)); found {
+		t.Error("saveSnapshot wrote content for snapshot 1")
+	}
+}
+
+func TestDiffItems(t *testing.T) {
+	a := []BlogPost{
+		{ID: "1", Title: "Kept"},
+		{ID: "2", Title: "Edited", HTMLContent: "<p>old</p>"},
+		{ID: "3", Title: "Deleted"},
+	}
+	b := []BlogPost{
+		{ID: "4", Title: "New"},
+		{ID: "2", Title: "Edited", HTMLContent: "<p>new</p>"},
+		{ID: "1", Title: "Kept"},
+	}
+
+	tests := []struct {
+		name string
+		a, b []BlogPost
+		want ItemDiff
+	}{
+		{"identical", a, a, ItemDiff{}},
+		{"both empty", nil, nil, ItemDiff{}},
+		{"changes", a, b, ItemDiff{
+			Added:   []DiffItem{{ID: "4", Name: "New"}},
+			Removed: []DiffItem{{ID: "3", Name: "Deleted"}},
+			Changed: []DiffItem{{ID: "2", Name: "Edited"}},
+		}},
+		{"from nothing", nil, a[:1], ItemDiff{Added: []DiffItem{{ID: "1", Name: "Kept"}}}},
+		{"to nothing", a[:1], nil, ItemDiff{Removed: []DiffItem{{ID: "1", Name: "Kept"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := indexContent(content{Posts: tt.a})
+			b, _, _ := indexContent(content{Posts: tt.b})
+			got := diffItems(postItems(a), postItems(b))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffItems = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
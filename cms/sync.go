@@ -1,58 +1,267 @@
-//go:build js && wasm
-
 package cms
 
 import (
-	"cloudflare-worker-boilerplate/utils"
+	"cloudflare-worker-boilerplate/store"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 )
 
-// SyncContent orchestrates fetching from Drive/Photos and saving to KV
-func SyncContent(driveFolderID, driveApiKey, photosApiKey string) (string, error) {
-	status := "Starting Sync...\n"
+// SyncOptions tunes how SyncContent saves what it fetched
+type SyncOptions struct {
+	// SnapshotsKept is how many published snapshots to keep,
+	// DefaultSnapshotsKept when 0. Staged ones don't count, see pruneSnapshots.
+	SnapshotsKept int
+
+	// Checks must pass before the synced content goes live
+	Checks PublishChecks
+}
 
-	// 1. Sync Blog Posts
-	status += fmt.Sprintf("Fetching Blog Posts from Folder: %s...\n", driveFolderID)
-	posts, err := FetchBlogPosts(driveFolderID, driveApiKey)
+// SyncContent orchestrates fetching from Drive/Photos and saving to st.
+// Cosplay albums come from the cosplayFolderID Drive folder when it is set,
+// otherwise from Google Photos. photos may be nil when no Photos access
+// token is available.
+// A source that fails keeps its previous content. When anything changed the
+// result is staged as a new snapshot and made live only if it passes
+// opts.Checks; otherwise the previous content stays live.
+// The returned error is non-nil when the sync failed; the result is always
+// filled in and describes what went wrong.
+func SyncContent(st store.Store, drive *DriveClient, driveFolderID, cosplayFolderID string, photos *PhotosClient, opts SyncOptions) (*SyncResult, error) {
+	result := newSyncResult()
+
+	liveID, err := CurrentSnapshot(st)
 	if err != nil {
-		status += fmt.Sprintf("Error fetching posts: %v\n", err)
-	} else {
-		status += fmt.Sprintf("Found %d posts.\n", len(posts))
-
-		// Serialize and Store
-		postsJSON, _ := json.Marshal(posts)
-		if err := utils.KVSet("blog_data", string(postsJSON)); err != nil {
-			status += fmt.Sprintf("Error saving blog_data to KV: %v\n", err)
-		} else {
-			status += "Saved blog_data to KV.\n"
+		result.Publish = &PublishResult{Error: fmt.Sprintf("reading the current snapshot: %v", err)}
+		result.finish()
+		return result, result.Err()
+	}
+	// Unreadable content just means every file is downloaded again
+	live, err := loadContent(st, liveID)
+	if err != nil {
+		fmt.Println("Error reading live content:", err)
+	}
+
+	next := live
+	syncBlog(st, result.source("blog"), drive, driveFolderID, live, &next)
+	syncCosplays(st, result.source("cosplays"), drive, cosplayFolderID, photos, live, &next)
+
+	result.Publish = publishContent(st, liveID, live, next, opts)
+	result.finish()
+	return result, result.Err()
+}
+
+// publishContent stages next as a new snapshot, unless it is the same as the
+// live content or the last staged snapshot, and makes it live if it passes
+// the checks. Going live only moves the current pointer, so readers see
+// either all of the old content or all of the new.
+func publishContent(st store.Store, liveID int, live, next content, opts SyncOptions) *PublishResult {
+	report := &PublishResult{Snapshot: liveID}
+	// Content still in the unversioned keys is saved as the first snapshot
+	// even when unchanged
+	legacy := liveID == 0 && (len(live.Posts) > 0 || len(live.Albums) > 0)
+	if !legacy && sameContent(live, next) {
+		report.Notes = append(report.Notes, "No changes, skipped saving a snapshot.")
+		return report
+	}
+
+	report.Checks = opts.Checks.runChecks(live, next)
+	failed := failedChecks(report.Checks)
+
+	// Syncs that keep failing the same check would otherwise stage the same
+	// content again every time
+	snapshots, err := ListSnapshots(st)
+	if err != nil {
+		report.Error = fmt.Sprintf("listing snapshots: %v", err)
+		return report
+	}
+	snap, found := latestStaged(snapshots, liveID)
+	if found && snap.Hash == contentHash(next) {
+		report.Notes = append(report.Notes, fmt.Sprintf("Same content as staged snapshot %d, skipped saving a snapshot.", snap.ID))
+	} else if snap, err = saveSnapshot(st, next, len(failed) > 0); err != nil {
+		report.Error = fmt.Sprintf("saving snapshot: %v", err)
+		return report
+	}
+
+	if len(failed) > 0 {
+		report.Staged = snap.ID
+		var msgs []string
+		for _, c := range failed {
+			msgs = append(msgs, c.Message)
+		}
+		report.Error = "checks failed: " + strings.Join(msgs, "; ")
+		report.Notes = append(report.Notes, fmt.Sprintf(
+			"Snapshot %d is staged but not published. Diff it against the live snapshot and roll back to it to publish anyway.", snap.ID))
+		if report.Pruned, err = pruneSnapshots(st, opts.SnapshotsKept, snap.ID); err != nil {
+			report.Notes = append(report.Notes, fmt.Sprintf("Error pruning old snapshots: %v", err))
 		}
+		return report
+	}
+
+	if err := publishSnapshot(st, snap.ID); err != nil {
+		report.Error = fmt.Sprintf("making snapshot %d live: %v", snap.ID, err)
+		return report
 	}
+	report.Snapshot, report.Previous = snap.ID, liveID
 
-	// 2. Sync Cosplay Albums
-	// For now, we assume public albums or API key access (which has limits as discussed)
-	// In a real app we'd need an Access Token passed in here.
-	// For this demo, assuming 'photosApiKey' is actually an access token or we skip if empty.
-	if photosApiKey != "" {
-		status += "Fetching Cosplay Albums...\n"
-		// TODO: In real usage, photosApiKey here should be an OAuth Access Token
-		albums, err := FetchCosplayAlbums(photosApiKey)
+	if report.Pruned, err = pruneSnapshots(st, opts.SnapshotsKept, snap.ID); err != nil {
+		report.Notes = append(report.Notes, fmt.Sprintf("Error pruning old snapshots: %v", err))
+	}
+	return report
+}
+
+// sameContent compares content as it would be stored
+func sameContent(a, b content) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
+
+// 1. Sync Blog Posts
+func syncBlog(st store.Store, report *SourceResult, drive *DriveClient, driveFolderID string, live content, next *content) {
+	result, err := drive.SyncBlogPosts(driveFolderID, live.Manifest, live.Posts)
+	if err != nil {
+		report.fail(fmt.Errorf("fetching posts from folder %s: %w", driveFolderID, err))
+		return
+	}
+
+	// Posts link their Docs images by key, so store the images first
+	if err := saveDocImages(st, result.Posts); err != nil {
+		report.fail(err)
+		return
+	}
+
+	report.Added, report.Updated, report.Unchanged = result.Added, result.Updated, result.Unchanged
+	report.Removed, report.Failed = result.Removed, result.Failed
+	for _, fileErr := range result.Errors {
+		report.Errors = append(report.Errors, itemError(fileErr))
+	}
+	if !result.Changed() {
+		report.note("No blog changes.")
+	}
+
+	// The manifest is saved in the same snapshot as the posts it describes,
+	// so a rollback can't make the next sync skip files it should fetch
+	next.Posts, next.Manifest = result.Posts, result.Manifest
+}
+
+// 2. Sync Cosplay Albums
+func syncCosplays(st store.Store, report *SourceResult, drive *DriveClient, cosplayFolderID string, photos *PhotosClient, live content, next *content) {
+	var result AlbumSync
+	var err error
+	switch {
+	case cosplayFolderID != "":
+		// Drive folders don't need the OAuth token the Photos API does
+		result, err = drive.FetchCosplayAlbums(cosplayFolderID)
+		if err != nil {
+			report.fail(fmt.Errorf("fetching albums from folder %s: %w", cosplayFolderID, err))
+			return
+		}
+	case photos != nil && photos.AccessToken != "":
+		// For now, we assume public albums or API key access (which has limits as discussed)
+		result, err = photos.FetchCosplayAlbums()
 		if err != nil {
-			status += fmt.Sprintf("Error fetching albums: %v\n", err)
-		} else {
-			status += fmt.Sprintf("Found %d albums.\n", len(albums))
-
-			albumsJSON, _ := json.Marshal(albums)
-			if err := utils.KVSet("cosplay_data", string(albumsJSON)); err != nil {
-				status += fmt.Sprintf("Error saving cosplay_data to KV: %v\n", err)
-			} else {
-				status += "Saved cosplay_data to KV.\n"
+			report.fail(fmt.Errorf("fetching albums: %w", err))
+			return
+		}
+	default:
+		report.skip("No cosplay Drive folder or Photos API key/token provided.")
+		return
+	}
+
+	previous := live.Albums
+	albums := result.Albums
+	warnMissingCaptions(report, result.Albums)
+	report.Warnings = append(report.Warnings, checkAlbumDates(result.Albums)...)
+	report.Failed = len(result.Errors)
+	for _, albumErr := range result.Errors {
+		report.Errors = append(report.Errors, itemError(albumErr))
+		// Keep serving the last good copy of an album we couldn't read
+		var ae *AlbumError
+		if errors.As(albumErr, &ae) {
+			for _, old := range previous {
+				if old.ID == ae.AlbumID {
+					albums = append(albums, old)
+				}
 			}
 		}
+	}
+	report.Warnings = append(report.Warnings, applyCovers(albums, loadCoverOverrides(st))...)
+	countAlbumChanges(report, previous, albums)
+	next.Albums = albums
+}
+
+// loadCoverOverrides reads the admin-set covers
+func loadCoverOverrides(st store.Store) CoverOverrides {
+	overrides, _, err := store.GetJSON[CoverOverrides](st, coverOverridesKey)
+	if err != nil {
+		fmt.Println("Error reading cover overrides:", err)
+	}
+	if overrides == nil {
+		overrides = CoverOverrides{}
+	}
+	return overrides
+}
+
+// SetCoverOverride picks the cover for an album by position, filename or
+// media ID, or clears the override when selector is empty. The live snapshot
+// is never changed in place: the new cover goes live as a snapshot of its
+// own, which can be rolled back like a sync, and the override is reapplied
+// on every sync. Old snapshots are pruned by the next sync.
+func SetCoverOverride(st store.Store, albumID, selector string) error {
+	// Unlike the sync, don't carry on without the saved overrides: they
+	// would all be lost when the map is written back
+	overrides, _, err := store.GetJSON[CoverOverrides](st, coverOverridesKey)
+	if err != nil {
+		return fmt.Errorf("reading cover overrides: %w", err)
+	}
+	if overrides == nil {
+		overrides = CoverOverrides{}
+	}
+	if selector == "" {
+		delete(overrides, albumID)
 	} else {
-		status += "Skipping Photos Sync (No API Key/Token provided).\n"
+		overrides[albumID] = selector
+	}
+
+	liveID, err := CurrentSnapshot(st)
+	if err != nil {
+		return err
+	}
+	live, err := loadContent(st, liveID)
+	if err != nil {
+		return err
+	}
+	i := -1
+	for j, album := range live.Albums {
+		if album.ID == albumID {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		return inputErrorf("album %s not found", albumID)
+	}
+
+	next := live
+	next.Albums = append([]CosplayAlbum(nil), live.Albums...)
+	album := next.Albums[i : i+1]
+	// Work out the cover again from scratch, so clearing an override falls
+	// back to the album's own choice
+	album[0].CoverImage = coverURL(album[0].Images)
+	if warnings := applyCovers(album, overrides); len(warnings) > 0 && selector != "" {
+		return &InputError{Message: warnings[0].Message}
 	}
 
-	status += "Sync Complete."
-	return status, nil
+	if err := store.PutJSON(st, coverOverridesKey, overrides, store.PutOptions{}); err != nil {
+		return fmt.Errorf("saving cover overrides to KV: %w", err)
+	}
+	if sameContent(live, next) {
+		return nil
+	}
+	snap, err := saveSnapshot(st, next, false)
+	if err != nil {
+		return fmt.Errorf("saving snapshot: %w", err)
+	}
+	return publishSnapshot(st, snap.ID)
 }
@@ -0,0 +1,137 @@
+package cms
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// albumDateLayouts are accepted for the Date: album metadata. Each maps to
+// the ISO layout it is stored as, keeping the precision that was given.
+var albumDateLayouts = []struct{ in, out string }{
+	{"2006-01-02", "2006-01-02"},
+	{"2006-01", "2006-01"},
+	{"2006", "2006"},
+	{"January 2, 2006", "2006-01-02"},
+	{"Jan 2, 2006", "2006-01-02"},
+	{"2 January 2006", "2006-01-02"},
+	{"2 Jan 2006", "2006-01-02"},
+	{"January 2006", "2006-01"},
+	{"Jan 2006", "2006-01"},
+}
+
+// normalizeAlbumDate turns a Date: value into YYYY-MM-DD, YYYY-MM or YYYY.
+// Values that can't be parsed are returned unchanged and reported by
+// checkAlbumDates.
+func normalizeAlbumDate(s string) string {
+	s = strings.TrimSpace(s)
+	for _, l := range albumDateLayouts {
+		if t, err := time.Parse(l.in, s); err == nil {
+			return t.Format(l.out)
+		}
+	}
+	return s
+}
+
+// parseAlbumDate reads a normalized album date
+func parseAlbumDate(s string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ShotAt is when the album was shot: its Date: metadata, or else its
+// earliest dated photo (TakenAt in the album index). Zero when neither is
+// known.
+func (a CosplayAlbum) ShotAt() time.Time {
+	if t, ok := parseAlbumDate(a.Date); ok {
+		return t
+	}
+	earliest := a.TakenAt
+	for _, m := range a.Images {
+		if !m.TakenAt.IsZero() && (earliest.IsZero() || m.TakenAt.Before(earliest)) {
+			earliest = m.TakenAt
+		}
+	}
+	return earliest
+}
+
+// SortAlbums returns the albums newest first. Undated albums go last, in
+// their original order.
+func SortAlbums(albums []CosplayAlbum) []CosplayAlbum {
+	sorted := make([]CosplayAlbum, len(albums))
+	copy(sorted, albums)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].ShotAt(), sorted[j].ShotAt()
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero() && b.IsZero()
+		}
+		return a.After(b)
+	})
+	return sorted
+}
+
+// TimelineYear groups a year's albums by event, newest event first
+type TimelineYear struct {
+	Year   int // 0 for undated albums
+	Events []TimelineEvent
+}
+
+// TimelineEvent is one convention or event. Name is empty for albums that
+// weren't shot at an event.
+type TimelineEvent struct {
+	Name   string
+	Albums []CosplayAlbum
+}
+
+// AlbumTimeline groups albums by year and then by event, newest first
+func AlbumTimeline(albums []CosplayAlbum) []TimelineYear {
+	var years []TimelineYear
+	for _, album := range SortAlbums(albums) {
+		year := 0
+		if t := album.ShotAt(); !t.IsZero() {
+			year = t.Year()
+		}
+		if len(years) == 0 || years[len(years)-1].Year != year {
+			years = append(years, TimelineYear{Year: year})
+		}
+		y := &years[len(years)-1]
+
+		// Albums are newest first, so events appear in order of their
+		// newest album
+		found := false
+		for i := range y.Events {
+			if strings.EqualFold(y.Events[i].Name, album.Event) {
+				y.Events[i].Albums = append(y.Events[i].Albums, album)
+				found = true
+				break
+			}
+		}
+		if !found {
+			y.Events = append(y.Events, TimelineEvent{Name: album.Event, Albums: []CosplayAlbum{album}})
+		}
+	}
+	return years
+}
+
+// checkAlbumDates flags Date: metadata that couldn't be understood
+func checkAlbumDates(albums []CosplayAlbum) []ItemError {
+	var warnings []ItemError
+	for _, album := range albums {
+		if album.Date == "" {
+			continue
+		}
+		if _, ok := parseAlbumDate(album.Date); !ok {
+			warnings = append(warnings, ItemError{
+				ID:      album.ID,
+				Name:    album.Title,
+				Message: fmt.Sprintf("Date metadata %q not recognised, use YYYY-MM-DD", album.Date),
+			})
+		}
+	}
+	return warnings
+}
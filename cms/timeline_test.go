@@ -0,0 +1,54 @@
+package cms
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalizeAlbumDate(t *testing.T) {
+	tests := map[string]string{
+		"2024-05-01":  "2024-05-01",
+		" 2024-05 ":   "2024-05",
+		"2024":        "2024",
+		"May 1, 2024": "2024-05-01",
+		"1 May 2024":  "2024-05-01",
+		"May 2024":    "2024-05",
+		"Spring 2024": "Spring 2024",
+		"":            "",
+	}
+	for in, want := range tests {
+		if got := normalizeAlbumDate(in); got != want {
+			t.Errorf("normalizeAlbumDate(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSortAlbums(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	albums := []CosplayAlbum{
+		{ID: "undated-1"},
+		{ID: "2023", Date: "2023"},
+		{ID: "photos-2024-06", Images: []CosplayMedia{{TakenAt: day(2024, 6, 9)}, {TakenAt: day(2024, 6, 2)}}},
+		{ID: "index-2024-03", TakenAt: day(2024, 3, 1)},
+		{ID: "undated-2", Date: "Spring"},
+		{ID: "2024-05", Date: "2024-05"},
+		{ID: "date-beats-photos", Date: "2022-01-01", Images: []CosplayMedia{{TakenAt: day(2025, 1, 1)}}},
+	}
+	want := []string{"photos-2024-06", "2024-05", "index-2024-03", "2023", "date-beats-photos", "undated-1", "undated-2"}
+
+	sorted := SortAlbums(albums)
+	var got []string
+	for _, a := range sorted {
+		got = append(got, a.ID)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SortAlbums = %v, want %v", got, want)
+	}
+	if albums[0].ID != "undated-1" {
+		t.Error("SortAlbums reordered its argument")
+	}
+	if len(SortAlbums(nil)) != 0 {
+		t.Error("SortAlbums(nil) isn't empty")
+	}
+}
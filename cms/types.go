@@ -1,8 +1,15 @@
 package cms
 
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
 // BlogPost represents a blog post fetched from Google Drive
 type BlogPost struct {
 	ID          string   `json:"id"`
+	Slug        string   `json:"slug"` // URL key for /blog/{slug}, unique across posts
 	Title       string   `json:"title"`
 	Date        string   `json:"date"` // ISO 8601 YYYY-MM-DD
 	Tags        []string `json:"tags"`
@@ -10,17 +17,109 @@ type BlogPost struct {
 	ImageURL    string   `json:"image_url"` // Optional cover image from the doc? or metadata
 	Type        string   `json:"type"`      // Tutorial, Life Update, Vlog
 	Summary     string   `json:"summary"`
+
+	// Publishing. Drafts and posts scheduled for later are still synced but
+	// hidden until Published reports true.
+	Status    string    `json:"status,omitempty"` // draft or published (default)
+	PublishAt time.Time `json:"publish_at,omitzero"`
+
+	// Extra holds front matter keys that don't map to a field above
+	Extra map[string]any `json:"extra,omitempty"`
+
+	// docImages are the images a freshly exported Google Doc links to,
+	// downloaded by the sync and stored on their own, see doc_images.go
+	docImages []docImage
 }
 
 // CosplayAlbum represents a cosplay album from Google Photos
 type CosplayAlbum struct {
-	ID           string   `json:"id"`
-	Title        string   `json:"title"`        // From "Title | Series"
-	Series       string   `json:"series"`       // From "Title | Series"
-	CoverImage   string   `json:"cover_image"`  // First image in album
-	Images       []string `json:"images"`       // List of all image URLs
-	Photographer string   `json:"photographer"` // Parsed from Description
-	Assistant    string   `json:"assistant"`    // Parsed from Description
-	Location     string   `json:"location"`     // Parsed from Description
-	Description  string   `json:"description"`  // Parsed from Description
+	ID           string         `json:"id"`
+	Title        string         `json:"title"`        // From "Title | Series"
+	Series       string         `json:"series"`       // From "Title | Series"
+	CoverImage   string         `json:"cover_image"`  // First photo in album, unless Cover says otherwise
+	Images       []CosplayMedia `json:"images"`       // Photos and videos in album order
+	Photographer string         `json:"photographer"` // Parsed from Description
+	Assistant    string         `json:"assistant"`    // Parsed from Description
+	Location     string         `json:"location"`     // Parsed from Description
+	Description  string         `json:"description"`  // Parsed from Description
+
+	// Event is the convention or event the album was shot at, and Date the
+	// shoot date as YYYY-MM-DD (or YYYY-MM, YYYY). Parsed from Description.
+	Event string `json:"event,omitempty"`
+	Date  string `json:"date,omitempty"`
+
+	// Cover picks the cover photo by position (1 = first) or filename.
+	// Parsed from Description; applied at sync time, see applyCovers.
+	Cover string `json:"cover,omitempty"`
+
+	// TakenAt is when the earliest photo was taken. It is only set in the
+	// album index, which leaves Images out, so ShotAt works there too.
+	TakenAt time.Time `json:"taken_at,omitzero"`
+}
+
+// MediaKind tells photos and videos apart
+type MediaKind string
+
+const (
+	MediaPhoto MediaKind = "photo"
+	MediaVideo MediaKind = "video"
+)
+
+// CosplayMedia is one photo or video in a cosplay album
+type CosplayMedia struct {
+	ID       string    `json:"id,omitempty"` // Photos media item or Drive file ID
+	URL      string    `json:"url"`
+	Kind     MediaKind `json:"kind"`
+	Width    int       `json:"width,omitempty"`
+	Height   int       `json:"height,omitempty"`
+	Caption  string    `json:"caption,omitempty"` // The item's own description
+	Alt      string    `json:"alt,omitempty"`     // Caption, or generated when there is none
+	TakenAt  time.Time `json:"taken_at,omitzero"`
+	Filename string    `json:"filename,omitempty"`
+
+	// AlbumInfo is set when the description held the album's details
+	// rather than a caption, see FetchCosplayAlbumDetails
+	AlbumInfo bool `json:"album_info,omitempty"`
+}
+
+// UnmarshalJSON also accepts the plain image URL strings that older syncs
+// stored in cosplay_data
+func (m *CosplayMedia) UnmarshalJSON(data []byte) error {
+	var legacyURL string
+	if err := json.Unmarshal(data, &legacyURL); err == nil {
+		*m = CosplayMedia{URL: legacyURL, Kind: MediaPhoto}
+		return nil
+	}
+	type plain CosplayMedia
+	return json.Unmarshal(data, (*plain)(m))
+}
+
+// coverURL picks the first photo, falling back to the first item
+func coverURL(media []CosplayMedia) string {
+	for _, m := range media {
+		if m.Kind != MediaVideo {
+			return m.URL
+		}
+	}
+	if len(media) > 0 {
+		return media[0].URL
+	}
+	return ""
+}
+
+// fillAltText sets every item's alt text from its caption, generating one
+// from the album title and position for items without a description
+func fillAltText(album *CosplayAlbum) {
+	subject := album.Title + " cosplay"
+	if album.Series != "" {
+		subject = fmt.Sprintf("%s cosplay from %s", album.Title, album.Series)
+	}
+	for i := range album.Images {
+		m := &album.Images[i]
+		if m.Caption != "" {
+			m.Alt = m.Caption
+			continue
+		}
+		m.Alt = fmt.Sprintf("%s, %s %d of %d", subject, m.Kind, i+1, len(album.Images))
+	}
 }
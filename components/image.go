@@ -0,0 +1,77 @@
+package components
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/a-h/templ"
+)
+
+// ImageWidths are the widths offered to the browser in a srcset
+var ImageWidths = []int{320, 480, 640, 960, 1280, 1920}
+
+// Sizes for the layouts that use responsive images. Each describes how wide
+// the image is drawn so the browser can pick the smallest good candidate.
+const (
+	SizesGalleryCard = "(min-width: 768px) 280px, 50vw"
+	SizesBlogCard    = "(min-width: 1024px) 33vw, (min-width: 640px) 50vw, 100vw"
+	SizesBlogFeed    = "(min-width: 1024px) 400px, (min-width: 768px) 50vw, 100vw"
+	SizesCosplayGrid = "(min-width: 1024px) 380px, (min-width: 640px) 50vw, 100vw"
+	SizesAlbumPopup  = "(min-width: 768px) 560px, 100vw"
+)
+
+// ResizedURL returns src scaled to width w, or "" when src isn't a URL we
+// know how to resize. Supported are Google-hosted images (=wN), and the
+// worker's /gphoto/ and /gdrivephoto/ proxies (?w=N).
+func ResizedURL(src string, w int) string {
+	u, err := url.Parse(src)
+	if err != nil {
+		return ""
+	}
+
+	switch {
+	case u.Host == "" && (strings.HasPrefix(u.Path, "/gphoto/") || strings.HasPrefix(u.Path, "/gdrivephoto/")):
+		q := u.Query()
+		if q.Get("kind") == "video" || q.Has("src") {
+			return ""
+		}
+		q.Set("w", fmt.Sprint(w))
+		u.RawQuery = q.Encode()
+		return u.String()
+	case strings.HasSuffix(u.Host, ".googleusercontent.com"):
+		// Size options follow the last "=" of the path: .../photo=w1920-h1080
+		path := u.Path
+		if i := strings.LastIndex(path, "="); i > strings.LastIndex(path, "/") {
+			path = path[:i]
+		}
+		u.Path = fmt.Sprintf("%s=w%d", path, w)
+		u.RawPath = ""
+		return u.String()
+	}
+	return ""
+}
+
+// SrcSet returns a srcset listing src at every ImageWidths width, or "" when
+// src can't be resized
+func SrcSet(src string) string {
+	var candidates []string
+	for _, w := range ImageWidths {
+		resized := ResizedURL(src, w)
+		if resized == "" {
+			return ""
+		}
+		candidates = append(candidates, fmt.Sprintf("%s %dw", resized, w))
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// ResponsiveImage returns the srcset and sizes attributes for an <img>
+// showing src, or no attributes when src can't be resized
+func ResponsiveImage(src, sizes string) templ.Attributes {
+	srcset := SrcSet(src)
+	if srcset == "" {
+		return templ.Attributes{}
+	}
+	return templ.Attributes{"srcset": srcset, "sizes": sizes}
+}
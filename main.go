@@ -1,5 +1,16 @@
+//go:build !(js && wasm)
+
 package main
 
-// This file exists only to satisfy Go's requirement for a main package.
-// When compiling to WASM, the actual entry points are the exported functions
-// in wasm.go (renderIndex, renderDynamicContent) that are called from JavaScript.
+import (
+	"fmt"
+	"os"
+)
+
+// The worker's entry point is main in wasm.go, built with GOOS=js GOARCH=wasm
+// (see the Makefile). This native main only exists so `go build ./...` and
+// `go vet ./...` work outside WASM; to run the site natively use cmd/devserver.
+func main() {
+	fmt.Fprintln(os.Stderr, "This package is the WASM worker, build it with `make build`. To run the site locally use `go run ./cmd/devserver`.")
+	os.Exit(1)
+}
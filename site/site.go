@@ -0,0 +1,220 @@
+// Package site renders the site's pages and runs the admin actions against a
+// content store. It has no syscall/js dependency so the same code serves the
+// worker (through the adapter in wasm.go) and the native dev server in
+// cmd/devserver.
+package site
+
+import (
+	"cloudflare-worker-boilerplate/cms"
+	"cloudflare-worker-boilerplate/pages"
+	"cloudflare-worker-boilerplate/store"
+	"cloudflare-worker-boilerplate/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Response is a rendered page or admin result with its HTTP status
+type Response struct {
+	Status int
+	Body   string
+}
+
+// Home renders / and /home
+func Home() string {
+	return utils.RenderToString(pages.Miseriae())
+}
+
+// Resume renders /resume
+func Resume() string {
+	return utils.RenderToString(pages.Resume())
+}
+
+// Base renders /base, the bare layout
+func Base() string {
+	return utils.RenderToString(pages.Base("Base", nil, nil, ""))
+}
+
+// Blog renders /blog from the post index, leaving out drafts and posts
+// scheduled for later than now
+func Blog(st store.Store) string {
+	return utils.RenderToString(pages.Blog(cms.PublishedPosts(cms.LoadPostIndex(st), time.Now())))
+}
+
+// BlogPost renders /blog/{slug}, with a 404 for unknown or unpublished slugs
+func BlogPost(st store.Store, slug string) Response {
+	post, ok := cms.LoadPost(st, slug)
+	if !ok || !post.Published(time.Now()) {
+		return Response{
+			Status: 404,
+			Body:   utils.RenderToString(pages.NotFound("We couldn't find that blog post.")),
+		}
+	}
+	return Response{Status: 200, Body: utils.RenderToString(pages.Post(post))}
+}
+
+// Cosplays renders /cosplays. query is the request's search string with the
+// facet filters. When fragment is true (an htmx request) only the chips and
+// grid are returned.
+func Cosplays(st store.Store, query string, fragment bool) string {
+	albums := cms.SortAlbums(cms.LoadAlbumIndex(st)) // newest first
+	filter := cms.ParseAlbumFilter(query)
+
+	if fragment {
+		return utils.RenderToString(pages.CosplayResults(albums, filter))
+	}
+	return utils.RenderToString(pages.Cosplays(albums, filter))
+}
+
+// CosplaySeries renders /cosplays/series
+func CosplaySeries(st store.Store) string {
+	return utils.RenderToString(pages.CosplaySeries(cms.SeriesIndex(cms.LoadAlbumIndex(st))))
+}
+
+// CosplayTimeline renders /cosplays/timeline
+func CosplayTimeline(st store.Store) string {
+	return utils.RenderToString(pages.CosplayTimeline(cms.AlbumTimeline(cms.LoadAlbumIndex(st))))
+}
+
+// CosplayAlbum answers /cosplays/album/{id} with the album's photos as JSON,
+// fetched when its popup is opened
+func CosplayAlbum(st store.Store, id string) Response {
+	album, ok := cms.LoadAlbum(st, id)
+	if !ok {
+		return Response{Status: 404, Body: `{"error":"album not found"}`}
+	}
+	raw, _ := json.Marshal(pages.PopupAlbum(album))
+	return Response{Status: 200, Body: string(raw)}
+}
+
+// DynamicContent renders /dynamic
+func DynamicContent(now time.Time) string {
+	items := []string{
+		fmt.Sprintf("Item generated at %s", now.Format(time.TimeOnly)),
+		"Another dynamic item",
+		"Random Value: " + fmt.Sprint(now.UnixNano()),
+	}
+
+	component := pages.DynamicContent(
+		"Dynamic Data",
+		items,
+		now.Format(time.RFC3339),
+		now.Format(time.RFC1123),
+		now.Format(time.Kitchen),
+		"/dynamic",
+	)
+
+	return utils.RenderToString(component)
+}
+
+// AdminResult is the answer to an admin endpoint, sent as JSON or as plain
+// text depending on what the client asked for
+type AdminResult struct {
+	Status int
+	JSON   string
+	Text   string
+}
+
+func adminResult(status int, v any, text string) AdminResult {
+	raw, _ := json.Marshal(v)
+	return AdminResult{Status: status, JSON: string(raw), Text: text}
+}
+
+func adminError(status int, err error) AdminResult {
+	return adminResult(status, map[string]string{"error": err.Error()}, err.Error()+"\n")
+}
+
+// errorStatus is 400 for a request that asked for something impossible, and
+// 500 when the store failed
+func errorStatus(err error) int {
+	var inputErr *cms.InputError
+	if errors.As(err, &inputErr) {
+		return 400
+	}
+	return 500
+}
+
+// SyncConfig says where /admin/sync reads content from
+type SyncConfig struct {
+	DriveFolderID     string
+	DriveAPIKey       string
+	PhotosAccessToken string // optional
+	PhotosAlbumPrefix string
+	CosplayFolderID   string // optional, preferred over Photos when set
+	SnapshotsKept     int    // optional, see cms.SyncOptions
+	DriveConcurrency  int    // optional, see cms.DriveClient.Concurrency
+	Checks            cms.PublishChecks
+}
+
+// Sync runs /admin/sync and reports on it with a cms.SyncResult
+func Sync(st store.Store, cfg SyncConfig) AdminResult {
+	drive := cms.NewDriveClient("", nil, cfg.DriveAPIKey)
+	if cfg.DriveConcurrency > 0 {
+		drive.Concurrency = cfg.DriveConcurrency
+	}
+	var photos *cms.PhotosClient
+	if cfg.PhotosAccessToken != "" {
+		photos = cms.NewPhotosClient("", nil, cfg.PhotosAccessToken)
+		photos.AlbumPrefix = cfg.PhotosAlbumPrefix
+	}
+	opts := cms.SyncOptions{SnapshotsKept: cfg.SnapshotsKept, Checks: cfg.Checks}
+	result, err := cms.SyncContent(st, drive, cfg.DriveFolderID, cfg.CosplayFolderID, photos, opts)
+
+	status := 200
+	if err != nil {
+		status = 500
+	}
+	return adminResult(status, result, result.Text())
+}
+
+// Snapshots runs /admin/snapshots, listing the saved snapshots newest first
+func Snapshots(st store.Store) AdminResult {
+	current, err := cms.CurrentSnapshot(st)
+	if err != nil {
+		return adminError(500, err)
+	}
+	snapshots, err := cms.ListSnapshots(st)
+	if err != nil {
+		return adminError(500, err)
+	}
+	body := map[string]any{"current": current, "snapshots": snapshots}
+	return adminResult(200, body, cms.SnapshotsText(snapshots, current))
+}
+
+// DiffSnapshots runs /admin/snapshots/diff, see cms.DiffSnapshots
+func DiffSnapshots(st store.Store, from, to int) AdminResult {
+	diff, err := cms.DiffSnapshots(st, from, to)
+	if err != nil {
+		return adminError(errorStatus(err), err)
+	}
+	return adminResult(200, diff, diff.Text())
+}
+
+// RollbackSnapshot runs /admin/snapshots/rollback, making snapshot id live
+func RollbackSnapshot(st store.Store, id int) AdminResult {
+	if err := cms.RollbackSnapshot(st, id); err != nil {
+		return adminError(errorStatus(err), err)
+	}
+	return adminResult(200, map[string]int{"current": id}, fmt.Sprintf("Snapshot %d is live\n", id))
+}
+
+// Migrate runs /admin/migrate, see cms.MigrateContent
+func Migrate(st store.Store) AdminResult {
+	result, err := cms.MigrateContent(st)
+	if err != nil {
+		return adminError(500, err)
+	}
+	return adminResult(200, result, result.Text())
+}
+
+// SetCover runs /admin/cover, see cms.SetCoverOverride. The body is plain text.
+func SetCover(st store.Store, albumID, selector string) Response {
+	if err := cms.SetCoverOverride(st, albumID, selector); err != nil {
+		return Response{Status: errorStatus(err), Body: err.Error()}
+	}
+	if selector == "" {
+		return Response{Status: 200, Body: fmt.Sprintf("Cover override for %s cleared", albumID)}
+	}
+	return Response{Status: 200, Body: fmt.Sprintf("Cover for %s set to %s", albumID, selector)}
+}
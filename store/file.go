@@ -0,0 +1,179 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// File is a Store kept in a directory, for the dev server. Each value is a
+// file under data/ holding exactly what was put, so synced content can be
+// read and edited by hand; metadata and expiry live in meta/ when set.
+// It is safe for concurrent use within one process.
+type File struct {
+	dir string
+	mu  sync.Mutex
+
+	// Now is the clock used for expiry; tests can replace it
+	Now func() time.Time
+}
+
+type fileMeta struct {
+	Metadata   map[string]any `json:"metadata,omitempty"`
+	Expiration time.Time      `json:"expiration,omitzero"`
+}
+
+// NewFile opens the store in dir, creating it if needed
+func NewFile(dir string) (*File, error) {
+	for _, sub := range []string{"data", "meta"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &File{dir: dir, Now: time.Now}, nil
+}
+
+// fileName escapes a key into a single path element that is valid on every
+// OS. Keys like "gphoto_url:<id>" contain characters Windows doesn't allow.
+func fileName(key string) string {
+	name := url.QueryEscape(key)
+	if strings.HasPrefix(name, ".") {
+		name = "%2E" + name[1:]
+	}
+	return name
+}
+
+func (f *File) dataPath(key string) string {
+	return filepath.Join(f.dir, "data", fileName(key))
+}
+
+func (f *File) metaPath(key string) string {
+	return filepath.Join(f.dir, "meta", fileName(key)+".json")
+}
+
+// readMeta returns the key's metadata and expiry, dropping the key if it has
+// expired. The caller holds f.mu.
+func (f *File) readMeta(key string) (fileMeta, bool, error) {
+	var meta fileMeta
+	raw, err := os.ReadFile(f.metaPath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return meta, true, nil
+	}
+	if err != nil {
+		return meta, false, err
+	}
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return meta, false, err
+	}
+	if !meta.Expiration.IsZero() && !f.Now().Before(meta.Expiration) {
+		return meta, false, f.remove(key)
+	}
+	return meta, true, nil
+}
+
+func (f *File) remove(key string) error {
+	for _, path := range []string{f.dataPath(key), f.metaPath(key)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *File) Get(key string) (string, error) {
+	e, err := f.GetWithMetadata(key)
+	return e.Value, err
+}
+
+func (f *File) GetWithMetadata(key string) (Entry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	meta, live, err := f.readMeta(key)
+	if err != nil {
+		return Entry{}, err
+	}
+	if !live {
+		return Entry{}, ErrNotFound
+	}
+	value, err := os.ReadFile(f.dataPath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Entry{}, ErrNotFound
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{Value: string(value), Metadata: meta.Metadata}, nil
+}
+
+func (f *File) Put(key, value string, opts PutOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	meta := fileMeta{Metadata: opts.Metadata}
+	if opts.TTL > 0 {
+		meta.Expiration = f.Now().Add(opts.TTL)
+	}
+	if meta.Metadata == nil && meta.Expiration.IsZero() {
+		if err := os.Remove(f.metaPath(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	} else {
+		raw, err := json.Marshal(meta)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(f.metaPath(key), raw, 0o644); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(f.dataPath(key), []byte(value), 0o644)
+}
+
+func (f *File) Delete(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.remove(key)
+}
+
+// List pages through keys in order. The cursor is the last key returned.
+func (f *File) List(opts ListOptions) (ListResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entries, err := os.ReadDir(filepath.Join(f.dir, "data"))
+	if err != nil {
+		return ListResult{}, err
+	}
+
+	var names []string
+	metas := map[string]fileMeta{}
+	for _, entry := range entries {
+		key, err := url.QueryUnescape(entry.Name())
+		if err != nil || entry.IsDir() {
+			continue // not written by this store
+		}
+		meta, live, err := f.readMeta(key)
+		if err != nil {
+			return ListResult{}, err
+		}
+		if live {
+			names = append(names, key)
+			metas[key] = meta
+		}
+	}
+
+	result := listPage(names, opts)
+	for i, k := range result.Keys {
+		meta := metas[k.Name]
+		result.Keys[i].Expiration, result.Keys[i].Metadata = meta.Expiration, meta.Metadata
+	}
+	return result, nil
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is an in-memory Store for tests and local development. It is safe
+// for concurrent use.
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+
+	// Now is the clock used for expiry; tests can replace it
+	Now func() time.Time
+}
+
+type memoryEntry struct {
+	value      string
+	metadata   map[string]any
+	expiration time.Time
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{entries: map[string]memoryEntry{}, Now: time.Now}
+}
+
+// lookup returns the live entry for key, dropping it if it has expired.
+// The caller holds m.mu.
+func (m *Memory) lookup(key string) (memoryEntry, bool) {
+	e, ok := m.entries[key]
+	if !ok {
+		return memoryEntry{}, false
+	}
+	if !e.expiration.IsZero() && !m.Now().Before(e.expiration) {
+		delete(m.entries, key)
+		return memoryEntry{}, false
+	}
+	return e, true
+}
+
+func (m *Memory) Get(key string) (string, error) {
+	e, err := m.GetWithMetadata(key)
+	return e.Value, err
+}
+
+func (m *Memory) GetWithMetadata(key string) (Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.lookup(key)
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	return Entry{Value: e.value, Metadata: e.metadata}, nil
+}
+
+func (m *Memory) Put(key, value string, opts PutOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := memoryEntry{value: value, metadata: opts.Metadata}
+	if opts.TTL > 0 {
+		e.expiration = m.Now().Add(opts.TTL)
+	}
+	m.entries[key] = e
+	return nil
+}
+
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+// List pages through keys in order. The cursor is the last key returned.
+func (m *Memory) List(opts ListOptions) (ListResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var names []string
+	for name := range m.entries {
+		if _, ok := m.lookup(name); ok {
+			names = append(names, name)
+		}
+	}
+
+	result := listPage(names, opts)
+	for i, k := range result.Keys {
+		e := m.entries[k.Name]
+		result.Keys[i].Expiration, result.Keys[i].Metadata = e.expiration, e.metadata
+	}
+	return result, nil
+}
+
+// listPage picks the names for one List page: those with the prefix, after
+// the cursor, in order and at most the limit. The cursor it returns is the
+// last name on the page.
+func listPage(names []string, opts ListOptions) ListResult {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+
+	var matched []string
+	for _, name := range names {
+		if strings.HasPrefix(name, opts.Prefix) && name > opts.Cursor {
+			matched = append(matched, name)
+		}
+	}
+	sort.Strings(matched)
+
+	result := ListResult{Complete: true}
+	if len(matched) > limit {
+		matched = matched[:limit]
+		result.Complete = false
+		result.Cursor = matched[len(matched)-1]
+	}
+	for _, name := range matched {
+		result.Keys = append(result.Keys, KeyInfo{Name: name})
+	}
+	return result
+}
@@ -0,0 +1,114 @@
+// Package store is a small key-value storage abstraction shaped after
+// Cloudflare Workers KV, so content can be read and written the same way in
+// the worker and in native code.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by Get when the key doesn't exist or has expired
+var ErrNotFound = errors.New("store: key not found")
+
+// Store is a key-value store with expiring keys and per-key metadata
+type Store interface {
+	// Get returns the value of key, or ErrNotFound
+	Get(key string) (string, error)
+
+	// GetWithMetadata returns the value of key with its metadata, or ErrNotFound
+	GetWithMetadata(key string) (Entry, error)
+
+	// Put writes key, replacing any existing value and metadata
+	Put(key, value string, opts PutOptions) error
+
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(key string) error
+
+	// List returns keys in lexicographic order, one page at a time
+	List(opts ListOptions) (ListResult, error)
+}
+
+// Entry is a stored value with its metadata
+type Entry struct {
+	Value    string
+	Metadata map[string]any
+}
+
+// PutOptions controls how a value is written. The zero value stores the key
+// without expiry or metadata.
+type PutOptions struct {
+	// TTL expires the key after this long. Workers KV requires at least 60s.
+	TTL time.Duration
+
+	// Metadata is a small JSON-serializable map kept alongside the value and
+	// returned by List without reading the value
+	Metadata map[string]any
+}
+
+// ListOptions selects a page of keys
+type ListOptions struct {
+	Prefix string
+	Cursor string // from a previous ListResult; empty for the first page
+	Limit  int    // 0 means the store's default (1000 for Workers KV)
+}
+
+// ListResult is one page of keys. Cursor is set when Complete is false.
+type ListResult struct {
+	Keys     []KeyInfo
+	Cursor   string
+	Complete bool
+}
+
+// KeyInfo describes one listed key
+type KeyInfo struct {
+	Name       string
+	Expiration time.Time // zero when the key doesn't expire
+	Metadata   map[string]any
+}
+
+// DefaultListLimit is the page size used when ListOptions.Limit is 0
+const DefaultListLimit = 1000
+
+// GetJSON reads key and decodes it into a T. found is false when the key
+// doesn't exist, which is not an error.
+func GetJSON[T any](s Store, key string) (value T, found bool, err error) {
+	raw, err := s.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return value, false, nil
+	}
+	if err != nil {
+		return value, false, err
+	}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return value, true, err
+	}
+	return value, true, nil
+}
+
+// PutJSON encodes v as JSON and writes it to key
+func PutJSON(s Store, key string, v any, opts PutOptions) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.Put(key, string(b), opts)
+}
+
+// ListAll follows the cursor until every key with prefix has been listed
+func ListAll(s Store, prefix string) ([]KeyInfo, error) {
+	var keys []KeyInfo
+	opts := ListOptions{Prefix: prefix}
+	for {
+		page, err := s.List(opts)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, page.Keys...)
+		if page.Complete || page.Cursor == "" {
+			return keys, nil
+		}
+		opts.Cursor = page.Cursor
+	}
+}
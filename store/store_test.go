@@ -0,0 +1,262 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// impl creates an empty store whose clock reads *now
+type impl struct {
+	name string
+	open func(t *testing.T, now *time.Time) Store
+}
+
+var impls = []impl{
+	{"Memory", func(t *testing.T, now *time.Time) Store {
+		m := NewMemory()
+		m.Now = func() time.Time { return *now }
+		return m
+	}},
+	{"File", func(t *testing.T, now *time.Time) Store {
+		f, err := NewFile(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Now = func() time.Time { return *now }
+		return f
+	}},
+}
+
+// forEach runs test against a fresh store of every kind
+func forEach(t *testing.T, test func(t *testing.T, s Store, now *time.Time)) {
+	for _, impl := range impls {
+		t.Run(impl.name, func(t *testing.T) {
+			now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+			test(t, impl.open(t, &now), &now)
+		})
+	}
+}
+
+func TestGetPutDelete(t *testing.T) {
+	keys := []string{"plain", "gphoto_url:AF1Qip-x_y", "content:00000012:blog_index", "a/b\\c", ".hidden", "../escape", "spaces and ünïcode"}
+
+	forEach(t, func(t *testing.T, s Store, now *time.Time) {
+		for _, key := range keys {
+			if _, err := s.Get(key); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get(%q) before Put: err = %v, want ErrNotFound", key, err)
+			}
+			if err := s.Put(key, "value of "+key, PutOptions{}); err != nil {
+				t.Fatalf("Put(%q): %v", key, err)
+			}
+		}
+		for _, key := range keys {
+			if got, err := s.Get(key); err != nil || got != "value of "+key {
+				t.Errorf("Get(%q) = %q, %v", key, got, err)
+			}
+		}
+
+		// Put replaces the value and the metadata
+		meta := map[string]any{"content_type": "image/png"}
+		if err := s.Put("plain", "with metadata", PutOptions{Metadata: meta}); err != nil {
+			t.Fatal(err)
+		}
+		if e, err := s.GetWithMetadata("plain"); err != nil || e.Value != "with metadata" || !reflect.DeepEqual(e.Metadata, meta) {
+			t.Errorf("GetWithMetadata = %+v, %v", e, err)
+		}
+		if err := s.Put("plain", "", PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if e, err := s.GetWithMetadata("plain"); err != nil || e.Value != "" || e.Metadata != nil {
+			t.Errorf("GetWithMetadata after plain Put = %+v, %v; want empty value, no metadata", e, err)
+		}
+
+		for _, key := range keys {
+			if err := s.Delete(key); err != nil {
+				t.Errorf("Delete(%q): %v", key, err)
+			}
+			if _, err := s.Get(key); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get(%q) after Delete: err = %v, want ErrNotFound", key, err)
+			}
+		}
+		if err := s.Delete("never-written"); err != nil {
+			t.Errorf("Delete of a missing key: %v", err)
+		}
+	})
+}
+
+func TestList(t *testing.T) {
+	forEach(t, func(t *testing.T, s Store, now *time.Time) {
+		for _, key := range []string{"post:c", "post:a", "album:x", "post:b", "posts", "post:d"} {
+			if err := s.Put(key, key, PutOptions{Metadata: map[string]any{"key": key}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tests := []struct {
+			name string
+			opts ListOptions
+			want []string
+			more bool
+		}{
+			{"everything", ListOptions{}, []string{"album:x", "post:a", "post:b", "post:c", "post:d", "posts"}, false},
+			{"prefix", ListOptions{Prefix: "post:"}, []string{"post:a", "post:b", "post:c", "post:d"}, false},
+			{"first page", ListOptions{Prefix: "post:", Limit: 3}, []string{"post:a", "post:b", "post:c"}, true},
+			{"after cursor", ListOptions{Prefix: "post:", Limit: 3, Cursor: "post:c"}, []string{"post:d"}, false},
+			{"exact page", ListOptions{Prefix: "post:", Limit: 4}, []string{"post:a", "post:b", "post:c", "post:d"}, false},
+			{"no match", ListOptions{Prefix: "cosplay"}, nil, false},
+		}
+		for _, tt := range tests {
+			page, err := s.List(tt.opts)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			var names []string
+			for _, k := range page.Keys {
+				names = append(names, k.Name)
+				if k.Metadata["key"] != k.Name {
+					t.Errorf("%s: %s listed with metadata %v", tt.name, k.Name, k.Metadata)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.want) || page.Complete == tt.more {
+				t.Errorf("%s: List = %v, complete %v; want %v, complete %v", tt.name, names, page.Complete, tt.want, !tt.more)
+			}
+			if tt.more && page.Cursor != tt.want[len(tt.want)-1] {
+				t.Errorf("%s: cursor = %q", tt.name, page.Cursor)
+			}
+		}
+	})
+}
+
+func TestListAllPages(t *testing.T) {
+	forEach(t, func(t *testing.T, s Store, now *time.Time) {
+		var want []string
+		for i := range DefaultListLimit + 5 {
+			key := fmt.Sprintf("k:%04d", i)
+			want = append(want, key)
+			if err := s.Put(key, "", PutOptions{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Put("other", "", PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		keys, err := ListAll(s, "k:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, k := range keys {
+			got = append(got, k.Name)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ListAll returned %d keys, want all %d across two pages", len(got), len(want))
+		}
+	})
+}
+
+func TestTTL(t *testing.T) {
+	forEach(t, func(t *testing.T, s Store, now *time.Time) {
+		if err := s.Put("short", "v", PutOptions{TTL: time.Minute}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put("forever", "v", PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		page, err := s.List(ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Keys) != 2 || !page.Keys[1].Expiration.Equal(now.Add(time.Minute)) || !page.Keys[0].Expiration.IsZero() {
+			t.Errorf("List before expiry = %+v", page.Keys)
+		}
+
+		*now = now.Add(59 * time.Second)
+		if got, err := s.Get("short"); err != nil || got != "v" {
+			t.Errorf("Get before expiry = %q, %v", got, err)
+		}
+
+		*now = now.Add(time.Second)
+		if _, err := s.Get("short"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get at expiry: err = %v, want ErrNotFound", err)
+		}
+		page, err = s.List(ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Keys) != 1 || page.Keys[0].Name != "forever" {
+			t.Errorf("List after expiry = %+v, want only forever", page.Keys)
+		}
+
+		// Writing the key again without a TTL makes it permanent
+		if err := s.Put("short", "v2", PutOptions{TTL: time.Minute}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put("short", "v3", PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		*now = now.Add(time.Hour)
+		if got, err := s.Get("short"); err != nil || got != "v3" {
+			t.Errorf("Get after rewriting without TTL = %q, %v", got, err)
+		}
+	})
+}
+
+func TestJSONHelpers(t *testing.T) {
+	type post struct {
+		Title string   `json:"title"`
+		Tags  []string `json:"tags"`
+	}
+
+	forEach(t, func(t *testing.T, s Store, now *time.Time) {
+		if v, found, err := GetJSON[post](s, "missing"); found || err != nil || !reflect.DeepEqual(v, post{}) {
+			t.Errorf("GetJSON(missing) = %+v, %v, %v; want zero, false, nil", v, found, err)
+		}
+
+		want := post{Title: "Hello", Tags: []string{"a", "b"}}
+		if err := PutJSON(s, "post", want, PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if raw, _ := s.Get("post"); raw != `{"title":"Hello","tags":["a","b"]}` {
+			t.Errorf("stored JSON = %s", raw)
+		}
+		if got, found, err := GetJSON[post](s, "post"); !found || err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("GetJSON(post) = %+v, %v, %v", got, found, err)
+		}
+
+		if err := s.Put("broken", "{", PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, found, err := GetJSON[post](s, "broken"); !found || err == nil {
+			t.Errorf("GetJSON(broken) found %v, err %v; want found with an error", found, err)
+		}
+
+		if err := PutJSON(s, "bad", func() {}, PutOptions{}); err == nil {
+			t.Error("PutJSON of a func succeeded")
+		}
+	})
+}
+
+func TestFileKeepsContentAcrossOpens(t *testing.T) {
+	dir := t.TempDir()
+	f, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Put("gphoto_url:x", "https://example.com", PutOptions{Metadata: map[string]any{"n": 1.0}}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := reopened.GetWithMetadata("gphoto_url:x")
+	if err != nil || e.Value != "https://example.com" || e.Metadata["n"] != 1.0 {
+		t.Errorf("after reopening: %+v, %v", e, err)
+	}
+}
@@ -0,0 +1,129 @@
+//go:build js && wasm
+
+package store
+
+import (
+	"cloudflare-worker-boilerplate/utils"
+	"encoding/json"
+	"errors"
+	"syscall/js"
+	"time"
+)
+
+// WorkersKV is a Store backed by a Workers KV namespace binding
+type WorkersKV struct {
+	ns js.Value
+}
+
+// NewWorkersKV wraps a KV namespace binding such as env.miseriaeentries. An
+// undefined binding gives a store whose every call fails, so pages can still
+// render without content.
+func NewWorkersKV(ns js.Value) *WorkersKV {
+	return &WorkersKV{ns: ns}
+}
+
+func (kv *WorkersKV) call(method string, args ...any) (js.Value, error) {
+	if kv.ns.IsUndefined() || kv.ns.IsNull() {
+		return js.Undefined(), errors.New("KV namespace binding not found")
+	}
+	return utils.Await(kv.ns.Call(method, args...))
+}
+
+func (kv *WorkersKV) Get(key string) (string, error) {
+	result, err := kv.call("get", key)
+	if err != nil {
+		return "", err
+	}
+	if result.IsNull() || result.IsUndefined() {
+		return "", ErrNotFound
+	}
+	return result.String(), nil
+}
+
+func (kv *WorkersKV) GetWithMetadata(key string) (Entry, error) {
+	result, err := kv.call("getWithMetadata", key)
+	if err != nil {
+		return Entry{}, err
+	}
+	value := result.Get("value")
+	if value.IsNull() || value.IsUndefined() {
+		return Entry{}, ErrNotFound
+	}
+	return Entry{Value: value.String(), Metadata: fromJS(result.Get("metadata"))}, nil
+}
+
+func (kv *WorkersKV) Put(key, value string, opts PutOptions) error {
+	options := map[string]any{}
+	if opts.TTL > 0 {
+		options["expirationTtl"] = int(opts.TTL.Seconds())
+	}
+	if opts.Metadata != nil {
+		metadata, err := toJS(opts.Metadata)
+		if err != nil {
+			return err
+		}
+		options["metadata"] = metadata
+	}
+	_, err := kv.call("put", key, value, options)
+	return err
+}
+
+func (kv *WorkersKV) Delete(key string) error {
+	_, err := kv.call("delete", key)
+	return err
+}
+
+func (kv *WorkersKV) List(opts ListOptions) (ListResult, error) {
+	options := map[string]any{}
+	if opts.Prefix != "" {
+		options["prefix"] = opts.Prefix
+	}
+	if opts.Cursor != "" {
+		options["cursor"] = opts.Cursor
+	}
+	if opts.Limit > 0 {
+		options["limit"] = opts.Limit
+	}
+
+	result, err := kv.call("list", options)
+	if err != nil {
+		return ListResult{}, err
+	}
+
+	out := ListResult{Complete: result.Get("list_complete").Truthy()}
+	if !out.Complete {
+		out.Cursor = result.Get("cursor").String()
+	}
+	keys := result.Get("keys")
+	for i := 0; i < keys.Length(); i++ {
+		k := keys.Index(i)
+		info := KeyInfo{Name: k.Get("name").String(), Metadata: fromJS(k.Get("metadata"))}
+		if exp := k.Get("expiration"); exp.Type() == js.TypeNumber {
+			info.Expiration = time.Unix(int64(exp.Float()), 0)
+		}
+		out.Keys = append(out.Keys, info)
+	}
+	return out, nil
+}
+
+// toJS and fromJS move metadata across the bridge as JSON, since js.ValueOf
+// only understands a few Go types
+func toJS(metadata map[string]any) (js.Value, error) {
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return js.Undefined(), err
+	}
+	return js.Global().Get("JSON").Call("parse", string(b)), nil
+}
+
+func fromJS(v js.Value) map[string]any {
+	if v.Type() != js.TypeObject {
+		return nil
+	}
+	var metadata map[string]any
+	raw := js.Global().Get("JSON").Call("stringify", v).String()
+	if err := json.Unmarshal([]byte(raw), &metadata); err != nil {
+		return nil
+	}
+	return metadata
+}
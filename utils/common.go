@@ -3,23 +3,11 @@
 package utils
 
 import (
-	"bytes"
-	"context"
 	"fmt"
 	"syscall/js"
 	"time"
-
-	"github.com/a-h/templ"
 )
 
-func RenderToString(c templ.Component) string {
-	var buf bytes.Buffer
-	if err := c.Render(context.Background(), &buf); err != nil {
-		return fmt.Sprintf("<div>Error rendering component: %v</div>", err)
-	}
-	return buf.String()
-}
-
 func RenderKV(this js.Value, args []js.Value) interface{} {
 	handler := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
 		resolve := args[0]
@@ -16,7 +16,7 @@ func KVGet(key string) (string, error) {
 
 	// kv.get(key) returns a Promise
 	promise := kv.Call("get", key)
-	result, err := await(promise)
+	result, err := Await(promise)
 	if err != nil {
 		return "", err
 	}
@@ -37,13 +37,13 @@ func KVSet(key, value string) error {
 
 	// kv.put(key, value) returns a Promise
 	promise := kv.Call("put", key, value)
-	_, err := await(promise)
+	_, err := Await(promise)
 	return err
 }
 
-// await waits for a JS promise to resolve or reject
+// Await waits for a JS promise to resolve or reject
 // It relies on the Go scheduler yielding to the JS event loop while waiting on the channel.
-func await(promise js.Value) (js.Value, error) {
+func Await(promise js.Value) (js.Value, error) {
 	resultCh := make(chan js.Value)
 	errCh := make(chan error)
 
@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/a-h/templ"
+)
+
+func RenderToString(c templ.Component) string {
+	var buf bytes.Buffer
+	if err := c.Render(context.Background(), &buf); err != nil {
+		return fmt.Sprintf("<div>Error rendering component: %v</div>", err)
+	}
+	return buf.String()
+}
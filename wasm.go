@@ -4,30 +4,45 @@ package main
 
 import (
 	"cloudflare-worker-boilerplate/cms"
-	"cloudflare-worker-boilerplate/pages"
+	"cloudflare-worker-boilerplate/site"
+	"cloudflare-worker-boilerplate/store"
 	"cloudflare-worker-boilerplate/utils"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"syscall/js"
 	"time"
-
-	"github.com/a-h/templ"
 )
 
+// wasm.go is the syscall/js adapter between worker.js and package site: it
+// unpacks the JS arguments, calls site and converts the result back. Page
+// logic belongs in site so the dev server in cmd/devserver can share it.
+
 func main() {
 	fmt.Println("Go: main started")
 	c := make(chan struct{})
-	registerTemplRoute("renderIndex", pages.Miseriae())
-	registerTemplRoute("renderHome", pages.Miseriae())
-	registerTemplRoute("renderResume", pages.Resume())
-	registerTemplRoute("renderBase", pages.Base("Base", nil, nil, ""))
+	registerPage("renderIndex", site.Home)
+	registerPage("renderHome", site.Home)
+	registerPage("renderResume", site.Resume)
+	registerPage("renderBase", site.Base)
 
 	// Dynamic Routes
 	js.Global().Set("renderBlog", js.FuncOf(renderBlog))
+	js.Global().Set("renderBlogPost", js.FuncOf(renderBlogPost))
 	js.Global().Set("renderCosplays", js.FuncOf(renderCosplays))
+	js.Global().Set("renderCosplaySeries", js.FuncOf(renderCosplaySeries))
+	js.Global().Set("renderCosplayTimeline", js.FuncOf(renderCosplayTimeline))
+	js.Global().Set("renderCosplayAlbum", js.FuncOf(renderCosplayAlbum))
 
 	// CMS Sync
 	js.Global().Set("syncContent", js.FuncOf(syncContent))
+	js.Global().Set("resolvePhotoURL", js.FuncOf(resolvePhotoURL))
+	js.Global().Set("loadDocImage", js.FuncOf(loadDocImage))
+	js.Global().Set("setCoverOverride", js.FuncOf(setCoverOverride))
+	js.Global().Set("listSnapshots", js.FuncOf(listSnapshots))
+	js.Global().Set("diffSnapshots", js.FuncOf(diffSnapshots))
+	js.Global().Set("rollbackSnapshot", js.FuncOf(rollbackSnapshot))
+	js.Global().Set("migrateContent", js.FuncOf(migrateContent))
 
 	js.Global().Set("renderKV", js.FuncOf(utils.RenderKV))
 	js.Global().Set("renderDynamicContent", js.FuncOf(renderDynamicContent))
@@ -35,75 +50,74 @@ func main() {
 	<-c
 }
 
-func registerTemplRoute(funcName string, page templ.Component) {
-	js.Global().Set(funcName, js.FuncOf(func(this js.Value, args []js.Value) any { return utils.RenderToString(page) }))
+func registerPage(funcName string, render func() string) {
+	js.Global().Set(funcName, js.FuncOf(func(this js.Value, args []js.Value) any { return render() }))
 }
 
-func renderBlog(this js.Value, args []js.Value) any {
-	// 1. Try to get data from KV
-	jsonStr, err := utils.KVGet("blog_data")
-	var posts []cms.BlogPost
-
-	// 2. Unmarshal if found
-	if err == nil && jsonStr != "" {
-		if err := json.Unmarshal([]byte(jsonStr), &posts); err != nil {
-			fmt.Println("Error unmarshaling blog_data:", err)
-		}
-	} else {
-		fmt.Println("No blog_data found in KV or error:", err)
+// storeArg wraps the KV namespace the worker passes as the first argument of
+// every function that reads or writes content, and returns the other args
+func storeArg(args []js.Value) (store.Store, []js.Value) {
+	if len(args) == 0 {
+		return store.NewWorkersKV(js.Undefined()), nil
 	}
-
-	// 3. Render
-	return utils.RenderToString(pages.Blog(posts))
+	return store.NewWorkersKV(args[0]), args[1:]
 }
 
-func renderCosplays(this js.Value, args []js.Value) any {
-	// 1. Try to get data from KV
-	jsonStr, err := utils.KVGet("cosplay_data")
-	var albums []cms.CosplayAlbum
-
-	// 2. Unmarshal if found
-	if err == nil && jsonStr != "" {
-		if err := json.Unmarshal([]byte(jsonStr), &albums); err != nil {
-			fmt.Println("Error unmarshaling cosplay_data:", err)
-		}
-	} else {
-		fmt.Println("No cosplay_data found in KV or error:", err)
+// stringArg returns args[i], or "" when it is missing or not a string
+func stringArg(args []js.Value, i int) string {
+	if len(args) > i && args[i].Type() == js.TypeString {
+		return args[i].String()
 	}
-
-	// 3. Render
-	return utils.RenderToString(pages.Cosplays(albums))
+	return ""
 }
 
-func syncContent(this js.Value, args []js.Value) any {
-	// Args: [driveFolderID, driveApiKey, photosApiKey]
-	if len(args) < 2 {
-		return "Error: specific driveFolderID and driveApiKey required"
+// intArg returns args[i] as an int, see toInt
+func intArg(args []js.Value, i int) int {
+	if len(args) <= i {
+		return 0
 	}
-	driveFolderID := args[0].String()
-	driveApiKey := args[1].String()
-	photosApiKey := ""
-	if len(args) > 2 {
-		photosApiKey = args[2].String()
+	return toInt(args[i])
+}
+
+// toInt accepts numbers and numeric strings, such as query parameters and
+// env vars; anything else gives 0
+func toInt(v js.Value) int {
+	switch v.Type() {
+	case js.TypeNumber:
+		return v.Int()
+	case js.TypeString:
+		n, _ := strconv.Atoi(v.String())
+		return n
 	}
+	return 0
+}
 
-	// Run sync in a goroutine? No, we want to return the result content.
-	// But sync might take time. We can return a Promise?
-	// For simplicity, we'll try to do it synchronously-ish (which blocks JS main thread in Wasm usually)
-	// But in standard Cloudflare Workers Wasm, blocking 'main' is okay for a bit.
-	// Ideally we return a Promise.
+// adminResult converts a site.AdminResult for the worker, which picks JSON
+// or text based on the request
+func adminResult(result site.AdminResult) map[string]any {
+	return map[string]any{"status": result.Status, "json": result.JSON, "text": result.Text}
+}
 
+// newPromise runs work in a goroutine, so it may wait on other promises such
+// as KV calls, and returns a Promise settled with its result
+func newPromise(name string, work func() (any, error)) js.Value {
 	handler := js.FuncOf(func(this js.Value, pArgs []js.Value) interface{} {
 		resolve := pArgs[0]
 		reject := pArgs[1]
 
 		go func() {
-			status, err := cms.SyncContent(driveFolderID, driveApiKey, photosApiKey)
+			defer func() {
+				if r := recover(); r != nil {
+					reject.Invoke(fmt.Sprintf("Panic in %s: %v", name, r))
+				}
+			}()
+
+			result, err := work()
 			if err != nil {
 				reject.Invoke(err.Error())
-			} else {
-				resolve.Invoke(status)
+				return
 			}
+			resolve.Invoke(result)
 		}()
 		return nil
 	})
@@ -112,22 +126,176 @@ func syncContent(this js.Value, args []js.Value) any {
 	return promiseConstructor.New(handler)
 }
 
+// renderBlog renders /blog. Args: [kv]
+func renderBlog(this js.Value, args []js.Value) any {
+	st, _ := storeArg(args)
+	return site.Blog(st)
+}
+
+// renderBlogPost renders /blog/{slug}. Args: [kv, slug]
+// Returns { status, body } so the worker can answer unknown slugs with a 404.
+func renderBlogPost(this js.Value, args []js.Value) any {
+	st, args := storeArg(args)
+	page := site.BlogPost(st, stringArg(args, 0))
+	return map[string]any{"status": page.Status, "body": page.Body}
+}
+
+// renderCosplays renders /cosplays. Args: [kv, query, fragment]
+// query is the request's search string with the facet filters. When fragment
+// is true (an htmx request) only the chips and grid are returned.
+func renderCosplays(this js.Value, args []js.Value) any {
+	st, args := storeArg(args)
+	fragment := len(args) > 1 && args[1].Truthy()
+	return site.Cosplays(st, stringArg(args, 0), fragment)
+}
+
+// renderCosplaySeries renders /cosplays/series. Args: [kv]
+func renderCosplaySeries(this js.Value, args []js.Value) any {
+	st, _ := storeArg(args)
+	return site.CosplaySeries(st)
+}
+
+// renderCosplayTimeline renders /cosplays/timeline. Args: [kv]
+func renderCosplayTimeline(this js.Value, args []js.Value) any {
+	st, _ := storeArg(args)
+	return site.CosplayTimeline(st)
+}
+
+// renderCosplayAlbum answers /cosplays/album/{id}. Args: [kv, id]
+// Returns { status, body, contentType } with the album popup's JSON.
+func renderCosplayAlbum(this js.Value, args []js.Value) any {
+	st, args := storeArg(args)
+	resp := site.CosplayAlbum(st, stringArg(args, 0))
+	return map[string]any{"status": resp.Status, "body": resp.Body, "contentType": "application/json"}
+}
+
+func syncContent(this js.Value, args []js.Value) any {
+	// Args: [kv, driveFolderID, driveApiKey, photosApiKey, photosAlbumPrefix, cosplayFolderID, options]
+	// options is { snapshotsKept, maxDeletePercent, minPosts, minAlbums }, any may be missing
+	// Resolves to { status, json, text } describing the cms.SyncResult
+	st, args := storeArg(args)
+	if len(args) < 2 {
+		return "Error: specific driveFolderID and driveApiKey required"
+	}
+	cfg := site.SyncConfig{
+		DriveFolderID:     stringArg(args, 0),
+		DriveAPIKey:       stringArg(args, 1),
+		PhotosAccessToken: stringArg(args, 2),
+		PhotosAlbumPrefix: stringArg(args, 3),
+		CosplayFolderID:   stringArg(args, 4),
+	}
+	if len(args) > 5 && args[5].Type() == js.TypeObject {
+		options := args[5]
+		cfg.SnapshotsKept = toInt(options.Get("snapshotsKept"))
+		cfg.DriveConcurrency = toInt(options.Get("driveConcurrency"))
+		cfg.Checks = cms.PublishChecks{
+			MaxDeletePercent: toInt(options.Get("maxDeletePercent")),
+			MinPosts:         toInt(options.Get("minPosts")),
+			MinAlbums:        toInt(options.Get("minAlbums")),
+		}
+	}
+
+	return newPromise("syncContent", func() (any, error) {
+		return adminResult(site.Sync(st, cfg)), nil
+	})
+}
+
+// listSnapshots backs /admin/snapshots. Args: [kv]
+// Resolves to { status, json, text }, as do diffSnapshots and rollbackSnapshot.
+func listSnapshots(this js.Value, args []js.Value) any {
+	st, _ := storeArg(args)
+	return newPromise("listSnapshots", func() (any, error) {
+		return adminResult(site.Snapshots(st)), nil
+	})
+}
+
+// diffSnapshots backs /admin/snapshots/diff. Args: [kv, from, to]
+// Either ID may be empty, see cms.DiffSnapshots.
+func diffSnapshots(this js.Value, args []js.Value) any {
+	st, args := storeArg(args)
+	from, to := intArg(args, 0), intArg(args, 1)
+	return newPromise("diffSnapshots", func() (any, error) {
+		return adminResult(site.DiffSnapshots(st, from, to)), nil
+	})
+}
+
+// rollbackSnapshot backs /admin/snapshots/rollback. Args: [kv, id]
+func rollbackSnapshot(this js.Value, args []js.Value) any {
+	st, args := storeArg(args)
+	id := intArg(args, 0)
+	return newPromise("rollbackSnapshot", func() (any, error) {
+		return adminResult(site.RollbackSnapshot(st, id)), nil
+	})
+}
+
+// migrateContent backs /admin/migrate. Args: [kv]
+func migrateContent(this js.Value, args []js.Value) any {
+	st, _ := storeArg(args)
+	return newPromise("migrateContent", func() (any, error) {
+		return adminResult(site.Migrate(st)), nil
+	})
+}
+
 func renderDynamicContent(this js.Value, args []js.Value) any {
-	now := time.Now()
-	items := []string{
-		fmt.Sprintf("Item generated at %s", now.Format(time.TimeOnly)),
-		"Another dynamic item",
-		"Random Value: " + fmt.Sprint(now.UnixNano()),
+	return site.DynamicContent(time.Now())
+}
+
+// resolvePhotoURL backs the /gphoto/{id} image proxy.
+// Args: [kv, mediaItemID, photosAccessToken]
+// Resolves to the media item's current baseUrl, or null when there is no such
+// photo. Without a token only the KV cache is checked and "" means the worker
+// should fetch a token and retry.
+func resolvePhotoURL(this js.Value, args []js.Value) any {
+	st, args := storeArg(args)
+	if len(args) < 1 {
+		return "Error: mediaItemID required"
 	}
+	mediaItemID := args[0].String()
+	accessToken := stringArg(args, 1)
+
+	return newPromise("resolvePhotoURL", func() (any, error) {
+		var photos *cms.PhotosClient
+		if accessToken != "" {
+			photos = cms.NewPhotosClient("", nil, accessToken)
+		}
+		baseURL, err := cms.ResolvePhotoURL(st, photos, mediaItemID)
+		if errors.Is(err, cms.ErrPhotoNotFound) {
+			return nil, nil
+		}
+		return baseURL, err
+	})
+}
 
-	component := pages.DynamicContent(
-		"Dynamic Data",
-		items,
-		now.Format(time.RFC3339),
-		now.Format(time.RFC1123),
-		now.Format(time.Kitchen),
-		"/dynamic",
-	)
+// loadDocImage backs /gdocimage/{key}. Args: [kv, key]
+// Resolves to { contentType, body } with body a Uint8Array, or null when no
+// image is stored under key.
+func loadDocImage(this js.Value, args []js.Value) any {
+	st, args := storeArg(args)
+	key := stringArg(args, 0)
 
-	return utils.RenderToString(component)
+	return newPromise("loadDocImage", func() (any, error) {
+		img, found, err := cms.LoadDocImage(st, key)
+		if err != nil || !found {
+			return nil, err
+		}
+		body := js.Global().Get("Uint8Array").New(len(img.Data))
+		js.CopyBytesToJS(body, img.Data)
+		return map[string]any{"contentType": img.ContentType, "body": body}, nil
+	})
+}
+
+// setCoverOverride backs /admin/cover. Args: [kv, albumID, selector]
+// Resolves to { status, text }.
+func setCoverOverride(this js.Value, args []js.Value) any {
+	st, args := storeArg(args)
+	if len(args) < 2 {
+		return "Error: albumID and selector required"
+	}
+	albumID := args[0].String()
+	selector := args[1].String()
+
+	return newPromise("setCoverOverride", func() (any, error) {
+		result := site.SetCover(st, albumID, selector)
+		return map[string]any{"status": result.Status, "text": result.Body}, nil
+	})
 }
@@ -53,6 +53,17 @@ const ROUTES = {
   },
   "/cosplays": {
     func: "renderCosplays",
+    withKV: true,
+    // Facet filters come from the query string; htmx asks for just the grid
+    withRequest: true,
+  },
+  "/cosplays/series": {
+    func: "renderCosplaySeries",
+    withKV: true,
+  },
+  "/cosplays/timeline": {
+    func: "renderCosplayTimeline",
+    withKV: true,
   },
   "/resume": {
     func: "renderResume",
@@ -62,6 +73,7 @@ const ROUTES = {
   },
   "/blog": {
     func: "renderBlog",
+    withKV: true,
   },
   "/kv": {
     func: "renderKV",
@@ -78,19 +90,12 @@ const ROUTES = {
   },
   "/admin/sync": {
     func: "syncContent",
-    setup: (env) => {
-      if (env.miseriaeentries) {
-        globalThis.KV = env.miseriaeentries;
-      }
-    },
     // handler override to pass env vars and secret check
     customHandler: async (request, env) => {
       const url = new URL(request.url);
-      const secret = url.searchParams.get("secret");
-      const expectedSecret = env.ADMIN_SECRET || "test"; // Fallback for dev
-
-      if (secret !== expectedSecret) {
-        return new Response("Unauthorized", { status: 401 });
+      const denied = requireAdmin(url, env);
+      if (denied) {
+        return denied;
       }
 
       if (typeof globalThis.syncContent !== "function") {
@@ -98,28 +103,16 @@ const ROUTES = {
       }
 
       try {
-        // Pass env vars: Folder ID, Drive Key, Photos Key
+        // Pass env vars: Folder ID, Drive Key, Photos Key, Photos album prefix,
+        // and the Drive folder holding cosplay albums (preferred over Photos when set)
         const folderId = env.DRIVE_FOLDER_ID || "";
         const driveKey = env.GOOGLE_API_KEY || "";
-        let photosKey = env.GOOGLE_PHOTOS_API_KEY || "";
-
-        // OAUTH FLOW: If Refresh Token variables are present, try to get a fresh Access Token
-        if (env.GOOGLE_CLIENT_ID && env.GOOGLE_CLIENT_SECRET && env.GOOGLE_REFRESH_TOKEN) {
-          console.log("Attempting to refresh Google Photos Access Token...");
-          try {
-            const newAccessToken = await getAccessToken(
-              env.GOOGLE_CLIENT_ID,
-              env.GOOGLE_CLIENT_SECRET,
-              env.GOOGLE_REFRESH_TOKEN
-            );
-            if (newAccessToken) {
-              photosKey = newAccessToken;
-              console.log("Successfully refreshed Access Token.");
-            }
-          } catch (oauthErr) {
-            console.error("OAuth Refresh Error:", oauthErr);
-            return new Response("OAuth Refresh Failed: " + oauthErr.message, { status: 500 });
-          }
+        let photosKey;
+        try {
+          photosKey = await getPhotosAccessToken(env);
+        } catch (oauthErr) {
+          console.error("OAuth Refresh Error:", oauthErr);
+          return new Response("OAuth Refresh Failed: " + oauthErr.message, { status: 500 });
         }
 
         // Just in case params override (for testing)
@@ -131,15 +124,265 @@ const ROUTES = {
           return new Response("Missing Configuration (DRIVE_FOLDER_ID or GOOGLE_API_KEY)", { status: 500 });
         }
 
-        const result = await globalThis.syncContent(folderId, driveKey, photosKey);
-        return new Response(result, { status: 200 });
+        const albumPrefix = env.PHOTOS_ALBUM_PREFIX || "";
+        const cosplayFolderId = env.COSPLAY_DRIVE_FOLDER_ID || "";
+        // Snapshots to keep, Drive files to download in parallel, and the
+        // checks a sync must pass before it goes live. Unset values use the
+        // defaults in Go.
+        const options = {
+          snapshotsKept: env.SNAPSHOTS_KEPT || "",
+          driveConcurrency: env.DRIVE_CONCURRENCY || "",
+          maxDeletePercent: env.PUBLISH_MAX_DELETE_PERCENT || "",
+          minPosts: env.PUBLISH_MIN_POSTS || "",
+          minAlbums: env.PUBLISH_MIN_ALBUMS || "",
+        };
+        const result = await globalThis.syncContent(
+          kvNamespace(env), folderId, driveKey, photosKey, albumPrefix, cosplayFolderId, options,
+        );
+        return adminResponse(request, url, result);
       } catch (e) {
         return new Response("Sync Error: " + e.message, { status: 500 });
       }
     }
   },
+  "/admin/cover": {
+    func: "setCoverOverride",
+    // POST /admin/cover?secret=...&album=<albumId>&cover=<position|filename>
+    // An empty cover clears the override.
+    customHandler: async (request, env) => {
+      const url = new URL(request.url);
+      const denied = requireAdmin(url, env);
+      if (denied) {
+        return denied;
+      }
+      if (request.method !== "POST") {
+        return new Response("Method Not Allowed", { status: 405, headers: { Allow: "POST" } });
+      }
+      if (typeof globalThis.setCoverOverride !== "function") {
+        return new Response("WASM setCoverOverride not initialized", { status: 500 });
+      }
+
+      const albumId = url.searchParams.get("album") || "";
+      const cover = url.searchParams.get("cover") || "";
+      if (!albumId) {
+        return new Response("Missing album", { status: 400 });
+      }
+
+      const result = await globalThis.setCoverOverride(kvNamespace(env), albumId, cover);
+      return new Response(result.text, {
+        status: result.status,
+        headers: { "Content-Type": "text/plain; charset=utf-8" },
+      });
+    }
+  },
+  // Every sync that changes content saves a numbered snapshot.
+  // GET /admin/snapshots?secret=... lists them, newest first.
+  "/admin/snapshots": {
+    func: "listSnapshots",
+    customHandler: async (request, env) => {
+      const url = new URL(request.url);
+      const denied = requireAdmin(url, env);
+      if (denied) {
+        return denied;
+      }
+      const result = await globalThis.listSnapshots(kvNamespace(env));
+      return adminResponse(request, url, result);
+    }
+  },
+  // GET /admin/snapshots/diff?secret=...&from=<id>&to=<id>
+  // to defaults to the live snapshot and from to the one before it.
+  "/admin/snapshots/diff": {
+    func: "diffSnapshots",
+    customHandler: async (request, env) => {
+      const url = new URL(request.url);
+      const denied = requireAdmin(url, env);
+      if (denied) {
+        return denied;
+      }
+      const from = url.searchParams.get("from") || "";
+      const to = url.searchParams.get("to") || "";
+      const result = await globalThis.diffSnapshots(kvNamespace(env), from, to);
+      return adminResponse(request, url, result);
+    }
+  },
+  // POST /admin/snapshots/rollback?secret=...&id=<id> makes an earlier
+  // snapshot live again
+  "/admin/snapshots/rollback": {
+    func: "rollbackSnapshot",
+    customHandler: async (request, env) => {
+      const url = new URL(request.url);
+      const denied = requireAdmin(url, env);
+      if (denied) {
+        return denied;
+      }
+      if (request.method !== "POST") {
+        return new Response("Method Not Allowed", { status: 405, headers: { Allow: "POST" } });
+      }
+      const id = url.searchParams.get("id") || "";
+      if (!id) {
+        return new Response("Missing id", { status: 400 });
+      }
+      const result = await globalThis.rollbackSnapshot(kvNamespace(env), id);
+      return adminResponse(request, url, result);
+    }
+  },
+  // POST /admin/migrate?secret=... moves content synced by older versions
+  // into the first snapshot. Safe to run more than once.
+  "/admin/migrate": {
+    func: "migrateContent",
+    customHandler: async (request, env) => {
+      const url = new URL(request.url);
+      const denied = requireAdmin(url, env);
+      if (denied) {
+        return denied;
+      }
+      if (request.method !== "POST") {
+        return new Response("Method Not Allowed", { status: 405, headers: { Allow: "POST" } });
+      }
+      const result = await globalThis.migrateContent(kvNamespace(env));
+      return adminResponse(request, url, result);
+    }
+  },
 };
 
+// Routes whose path carries a parameter, e.g. /blog/{slug}.
+// The remainder of the path after the prefix is passed as the first argument.
+const PREFIX_ROUTES = [
+  {
+    prefix: "/blog/",
+    func: "renderBlogPost",
+    withKV: true,
+  },
+  // An album's photos as JSON, fetched when its popup opens
+  {
+    prefix: "/cosplays/album/",
+    func: "renderCosplayAlbum",
+    withKV: true,
+  },
+];
+
+// The KV namespace Go reads and writes content in. Routes with withKV get it
+// as their first argument.
+function kvNamespace(env) {
+  if (!env.miseriaeentries) {
+    console.warn("KV binding 'miseriaeentries' not found");
+  }
+  return env.miseriaeentries;
+}
+
+// Admin routes need ?secret= to match ADMIN_SECRET. Returns the response
+// to send when it doesn't, or null.
+function requireAdmin(url, env) {
+  const secret = url.searchParams.get("secret");
+  const expectedSecret = env.ADMIN_SECRET || "test"; // Fallback for dev
+  if (secret !== expectedSecret) {
+    return new Response("Unauthorized", { status: 401 });
+  }
+  return null;
+}
+
+// Go admin functions resolve to { status, json, text }. JSON is sent by
+// default, plain text with ?format=text or Accept: text/plain.
+function adminResponse(request, url, result) {
+  const accept = request.headers.get("Accept") || "";
+  const wantsText =
+    url.searchParams.get("format") === "text" ||
+    (accept.includes("text/plain") && !accept.includes("application/json"));
+
+  if (wantsText) {
+    return new Response(result.text, {
+      status: result.status,
+      headers: { "Content-Type": "text/plain; charset=utf-8" },
+    });
+  }
+  return new Response(result.json, {
+    status: result.status,
+    headers: { "Content-Type": "application/json" },
+  });
+}
+
+// Headers for media passed on from Google: just the type, which must not be
+// sniffed, and a policy that stops anything in it from running
+function mediaHeaders(contentType) {
+  return new Headers({
+    "Content-Type": contentType,
+    "X-Content-Type-Options": "nosniff",
+    "Content-Security-Policy": "default-src 'none'",
+  });
+}
+
+// Passes on an upstream media response with fresh headers, only when it
+// succeeded and its Content-Type starts with one of allowedTypes
+function mediaResponse(upstream, allowedTypes) {
+  const contentType = upstream.headers.get("Content-Type") || "";
+  if (!upstream.ok || !allowedTypes.some((t) => contentType.startsWith(t))) {
+    return new Response("Bad Gateway", { status: 502 });
+  }
+  return new Response(upstream.body, { headers: mediaHeaders(contentType) });
+}
+
+// Decodes a percent-encoded path segment, or returns null when it is
+// malformed (e.g. /blog/%E0) and can't name anything
+function decodePathParam(segment) {
+  try {
+    return decodeURIComponent(segment);
+  } catch (e) {
+    return null;
+  }
+}
+
+// Width requested by a srcset candidate (?w=N), limited to sensible sizes
+function imageWidth(url) {
+  const width = parseInt(url.searchParams.get("w") || "", 10);
+  if (!width || width < 1) {
+    return 0;
+  }
+  return Math.min(width, 3840);
+}
+
+// htmx requests get a page fragment, except when htmx restores history
+// after a cache miss and needs the whole page
+function isFragmentRequest(request) {
+  return request.headers.get("HX-Request") === "true" &&
+    request.headers.get("HX-History-Restore-Request") !== "true";
+}
+
+// Go render functions return either an HTML string or
+// { status, body, contentType }, where contentType defaults to HTML
+function toHtmlResponse(result) {
+  if (result && typeof result === "object" && "body" in result) {
+    return new Response(result.body, {
+      status: result.status || 200,
+      headers: { "Content-Type": result.contentType || "text/html" },
+    });
+  }
+  return new Response(result, {
+    headers: { "Content-Type": "text/html" },
+  });
+}
+
+// Photos access token: GOOGLE_PHOTOS_API_KEY, or a fresh token from the
+// OAuth refresh token when GOOGLE_CLIENT_ID/SECRET/REFRESH_TOKEN are set
+async function getPhotosAccessToken(env) {
+  let photosKey = env.GOOGLE_PHOTOS_API_KEY || "";
+
+  // OAUTH FLOW: If Refresh Token variables are present, try to get a fresh Access Token
+  if (env.GOOGLE_CLIENT_ID && env.GOOGLE_CLIENT_SECRET && env.GOOGLE_REFRESH_TOKEN) {
+    console.log("Attempting to refresh Google Photos Access Token...");
+    const newAccessToken = await getAccessToken(
+      env.GOOGLE_CLIENT_ID,
+      env.GOOGLE_CLIENT_SECRET,
+      env.GOOGLE_REFRESH_TOKEN
+    );
+    if (newAccessToken) {
+      photosKey = newAccessToken;
+      console.log("Successfully refreshed Access Token.");
+    }
+  }
+
+  return photosKey;
+}
+
 // Helper to swap Refresh Token for Access Token
 async function getAccessToken(clientId, clientSecret, refreshToken) {
   const tokenEndpoint = "https://oauth2.googleapis.com/token";
@@ -191,16 +434,70 @@ export default {
       if (url.pathname.startsWith("/gdrivephoto/")) {
         const fileId = url.pathname.replace("/gdrivephoto/", "");
         if (fileId) {
-          const driveUrl = `https://drive.google.com/uc?id=${fileId}`;
+          // ?w=N (from srcset) uses Drive's thumbnail endpoint to get a smaller copy
+          const width = imageWidth(url);
+          const driveUrl = width
+            ? `https://drive.google.com/thumbnail?id=${encodeURIComponent(fileId)}&sz=w${width}`
+            : `https://drive.google.com/uc?id=${fileId}`;
           const imageResponse = await fetch(driveUrl);
-          // Create a new response to allow embedding (CORS/Headers if needed, 
-          // though usually direct proxying works fine for basic embedding).
-          // We return the response directly.
-          return new Response(imageResponse.body, {
-            headers: imageResponse.headers,
-            status: imageResponse.status,
-            statusText: imageResponse.statusText
-          });
+          // Drive albums hold videos as well as photos
+          return mediaResponse(imageResponse, ["image/", "video/"]);
+        }
+      }
+
+      // Images embedded in Google Docs, downloaded and stored by the sync
+      if (url.pathname.startsWith("/gdocimage/")) {
+        const key = url.pathname.slice("/gdocimage/".length);
+        if (!key || typeof globalThis.loadDocImage !== "function") {
+          return new Response("Not Found", { status: 404 });
+        }
+        const image = await globalThis.loadDocImage(kvNamespace(env), key);
+        if (!image) {
+          return new Response("Not Found", { status: 404 });
+        }
+        const headers = mediaHeaders(image.contentType);
+        // The key is derived from the image's source URL, so it never changes
+        headers.set("Cache-Control", "public, max-age=31536000, immutable");
+        return new Response(image.body, { headers });
+      }
+
+      // Handle Google Photos media items synced by ID. baseUrls expire after
+      // about an hour, so Go looks up a fresh one and caches it in KV.
+      if (url.pathname.startsWith("/gphoto/")) {
+        const mediaId = decodePathParam(url.pathname.slice("/gphoto/".length));
+        if (!mediaId || typeof globalThis.resolvePhotoURL !== "function") {
+          return new Response("Not Found", { status: 404 });
+        }
+        const kv = kvNamespace(env);
+        try {
+          // Only fetch an access token when the cached URL has expired
+          let baseUrl = await globalThis.resolvePhotoURL(kv, mediaId, "");
+          if (!baseUrl) {
+            const token = await getPhotosAccessToken(env);
+            if (!token) {
+              return new Response("Photos access not configured", { status: 503 });
+            }
+            baseUrl = await globalThis.resolvePhotoURL(kv, mediaId, token);
+          }
+          if (baseUrl === null) {
+            return new Response("Not Found", { status: 404 });
+          }
+
+          // =dv streams a video, =wN a still at the width asked for by srcset
+          const width = imageWidth(url);
+          let suffix = width ? `=w${width}` : "=w1920-h1080";
+          if (url.searchParams.get("kind") === "video") {
+            suffix = "=dv";
+          }
+          const imageResponse = await fetch(baseUrl + suffix);
+          const response = mediaResponse(imageResponse, ["image/", "video/"]);
+          if (response.ok) {
+            // The image behind a media item ID doesn't change
+            response.headers.set("Cache-Control", "public, max-age=86400");
+          }
+          return response;
+        } catch (e) {
+          return new Response("Photo Error: " + (e.message || e), { status: 502 });
         }
       }
 
@@ -278,11 +575,43 @@ export default {
 
         // Call the function, awaiting it just in case it returns a Promise (like renderKV)
         // If args are provided, pass them; otherwise call without args
-        const html = await globalThis[funcName](...(route.args || []));
+        const kvArgs = route.withKV ? [kvNamespace(env)] : [];
+        if (route.withRequest) {
+          const html = await globalThis[funcName](...kvArgs, url.search, isFragmentRequest(request));
+          const response = toHtmlResponse(html);
+          // The same URL serves a full page or an htmx fragment
+          response.headers.set("Vary", "HX-Request");
+          return response;
+        }
+        const html = await globalThis[funcName](...kvArgs, ...(route.args || []));
+
+        return toHtmlResponse(html);
+      }
+
+      const prefixRoute = PREFIX_ROUTES.find(
+        (r) => url.pathname.startsWith(r.prefix) && url.pathname.length > r.prefix.length,
+      );
+
+      if (prefixRoute) {
+        if (prefixRoute.setup) {
+          prefixRoute.setup(env);
+        }
+
+        const funcName = prefixRoute.func;
+        if (typeof globalThis[funcName] !== "function") {
+          throw new Error(
+            `${funcName} is not defined. WASM may not have initialized correctly.`,
+          );
+        }
+
+        const param = decodePathParam(url.pathname.slice(prefixRoute.prefix.length).replace(/\/$/, ""));
+        if (param === null) {
+          return new Response("Not Found", { status: 404 });
+        }
+        const kvArgs = prefixRoute.withKV ? [kvNamespace(env)] : [];
+        const result = await globalThis[funcName](...kvArgs, param);
 
-        return new Response(html, {
-          headers: { "Content-Type": "text/html" },
-        });
+        return toHtmlResponse(result);
       }
 
       return new Response("Not Found", { status: 404 });